@@ -1,13 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	chimw "github.com/go-chi/chi/v5/middleware"
 
 	"github.com/protean/vfs-server/internal/config"
+	"github.com/protean/vfs-server/internal/events"
+	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/handler"
+	"github.com/protean/vfs-server/internal/journal"
+	"github.com/protean/vfs-server/internal/metrics"
+	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
+	"github.com/protean/vfs-server/internal/ratelimit"
+	"github.com/protean/vfs-server/internal/tracing"
+	"github.com/protean/vfs-server/internal/usertoken"
+	"github.com/protean/vfs-server/internal/webhook"
 )
 
 func main() {
@@ -16,13 +35,162 @@ func main() {
 		log.Fatalf("config: %v", err)
 	}
 
-	router := handler.NewRouter(cfg.WorkspaceBase, cfg.ServiceTokens)
+	// Structured JSON logs on stdout. Setting the default also routes the
+	// standard log package through the same handler.
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel})))
 
-	// Wrap with Recovery and Logger at the outermost level
-	outerHandler := chimw.Recoverer(chimw.Logger(router))
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Endpoint:    cfg.OTLPEndpoint,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	users, err := fsops.NewUserDirs(cfg.WorkspaceBase, cfg.UserIDPolicy, cfg.UserIDPattern, cfg.UserDirLayout)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	// Background workers run until shutdown has drained the HTTP server.
+	background, stopBackground := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	broker := events.NewBroker(cfg.EventsHistory)
+	var watcher *events.Watcher
+	if cfg.EventsWatch {
+		watcher, err = events.NewWatcher(cfg.WorkspaceBase, users.Split, broker)
+		if err != nil {
+			log.Fatalf("events: %v", err)
+		}
+	}
+
+	hooks, err := webhook.OpenStore(filepath.Join(cfg.DataDir, "webhooks", "hooks.json"), cfg.WebhookAllowPrivate)
+	if err != nil {
+		log.Fatalf("webhooks: %v", err)
+	}
+	queue, err := webhook.OpenQueue(filepath.Join(cfg.DataDir, "webhooks", "queue"))
+	if err != nil {
+		log.Fatalf("webhooks: %v", err)
+	}
+	dispatcher := webhook.NewDispatcher(hooks, queue, webhook.Options{
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		AllowPrivate: cfg.WebhookAllowPrivate,
+	})
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(background, broker)
+	}()
+
+	audit, err := journal.Open(filepath.Join(cfg.DataDir, "audit"), int64(cfg.AuditMaxBytes), cfg.AuditMaxFiles, cfg.AuditSyncInterval)
+	if err != nil {
+		log.Fatalf("audit: %v", err)
+	}
+
+	tracker := quota.NewTracker(users, quota.Limits{
+		SoftBytes: int64(cfg.QuotaSoftBytes),
+		HardBytes: int64(cfg.QuotaHardBytes),
+		SoftFiles: int64(cfg.QuotaSoftFiles),
+		HardFiles: int64(cfg.QuotaHardFiles),
+	})
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		tracker.Run(background, cfg.QuotaReconcileInterval)
+	}()
+
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.ClassRead:  {Rate: cfg.RateReadPerSec, Burst: cfg.RateReadBurst},
+		ratelimit.ClassWrite: {Rate: cfg.RateWritePerSec, Burst: cfg.RateWriteBurst},
+	})
 
-	log.Printf("vfs-server listening on :%s (workspace=%s)", cfg.Port, cfg.WorkspaceBase)
-	if err := http.ListenAndServe(":"+cfg.Port, outerHandler); err != nil {
+	locker := fsops.NewPathLocker()
+
+	var stats *metrics.Metrics
+	if cfg.MetricsEnabled {
+		stats = metrics.New()
+		stats.WatchLocker(locker)
+		perUserTop := 0
+		if cfg.MetricsPerUser {
+			perUserTop = cfg.MetricsPerUserTop
+		}
+		stats.WatchQuota(tracker, perUserTop)
+	}
+
+	deps := &handler.Deps{
+		Users:      users,
+		Locker:     locker,
+		Events:     broker,
+		Webhooks:   hooks,
+		Journal:    audit,
+		UserTokens: usertoken.NewVerifier(cfg.UserTokenSecrets, cfg.UserTokenPublicKeys, cfg.UserTokenMaxTTL),
+		Quota:      tracker,
+		Limiter:    limiter,
+		Metrics:    stats,
+		Draining:   make(chan struct{}),
+	}
+	router := handler.NewRouter(deps, cfg)
+
+	// Logger is outermost so recovered panics are logged as 500s along with
+	// the request ID.
+	outerHandler := middleware.Logger(slog.Default())(chimw.Recoverer(router))
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           outerHandler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("vfs-server listening on :%s (workspace=%s)", cfg.Port, cfg.WorkspaceBase)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
 		log.Fatalf("server: %v", err)
+	case <-signals.Done():
+	}
+	// A second signal kills the process without waiting for the drain.
+	stopSignals()
+
+	log.Printf("shutting down: draining for %s", cfg.ShutdownDelay)
+	close(deps.Draining)
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	// Handlers that outlived the deadline may still be writing; give them
+	// what is left of it before closing the files they report to.
+	if err := deps.Locker.Wait(ctx); err != nil {
+		log.Printf("shutdown: writes still in progress: %v", err)
+	}
+
+	stopBackground()
+	workers.Wait()
+	if watcher != nil {
+		watcher.Close()
+	}
+	if err := audit.Close(); err != nil {
+		log.Printf("shutdown: audit: %v", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("shutdown: tracing: %v", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("server: %v", err)
 	}
+	log.Printf("vfs-server stopped")
 }
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +18,102 @@ type Config struct {
 	WorkspaceBase string
 	// ServiceTokens maps token → service name
 	ServiceTokens map[string]string
+	// ServicePolicies maps service name → scopes and path restrictions.
+	// Services without an entry get DefaultPolicy.
+	ServicePolicies map[string]Policy
+	// EventsHistory is how many change events are kept for Last-Event-ID resume.
+	EventsHistory int
+	// EventsWatch enables the inotify watcher for out-of-band changes.
+	EventsWatch bool
+	// DataDir holds server state such as webhooks and their delivery queue.
+	DataDir string
+	// WebhookMaxAttempts is how many times a delivery is tried before it is
+	// moved to the dead-letter directory.
+	WebhookMaxAttempts int
+	// WebhookAllowPrivate lets webhooks target loopback, link-local and
+	// private addresses, for development against local receivers.
+	WebhookAllowPrivate bool
+	// AuditMaxBytes is the size at which the audit journal is rotated.
+	AuditMaxBytes int
+	// AuditMaxFiles is how many rotated audit journal files are kept.
+	AuditMaxFiles int
+	// AuditSyncInterval batches audit journal fsyncs this far apart; zero
+	// syncs every entry as it is written.
+	AuditSyncInterval time.Duration
+	// UserTokenSecrets are HS256 keys for signed user-identity tokens.
+	UserTokenSecrets [][]byte
+	// UserTokenPublicKeys are Ed25519 keys for EdDSA user-identity tokens.
+	UserTokenPublicKeys []ed25519.PublicKey
+	// UserTokenRequired rejects requests that only send X-User-Id.
+	UserTokenRequired bool
+	// UserTokenMaxTTL caps the lifetime (exp - iat) of accepted user tokens.
+	UserTokenMaxTTL time.Duration
+	// UserIDPolicy is "charset" (UserIDPattern) or "uuid".
+	UserIDPolicy string
+	// UserIDPattern overrides the charset policy's regular expression.
+	UserIDPattern string
+	// UserDirLayout is "flat" (<base>/<id>) or "sharded" (<base>/ab/cd/<id>).
+	UserDirLayout string
+	// QuotaSoftBytes and QuotaHardBytes limit the bytes stored per user;
+	// QuotaSoftFiles and QuotaHardFiles limit the entries. Zero is unlimited.
+	QuotaSoftBytes int
+	QuotaHardBytes int
+	QuotaSoftFiles int
+	QuotaHardFiles int
+	// QuotaReconcileInterval is how often tracked usage is rescanned from disk.
+	QuotaReconcileInterval time.Duration
+	// RateReadPerSec and RateWritePerSec are the sustained request rates
+	// allowed per service and user; RateReadBurst and RateWriteBurst the
+	// bucket sizes. A zero rate disables limiting for that class.
+	RateReadPerSec  float64
+	RateReadBurst   int
+	RateWritePerSec float64
+	RateWriteBurst  int
+	// MaxJSONBody and MaxBinaryBody cap request bodies on JSON and multipart
+	// upload routes, in bytes. Zero disables the limit.
+	MaxJSONBody   int
+	MaxBinaryBody int
+	// ExtractMaxEntries, ExtractMaxBytes and ExtractMaxRatio bound what one
+	// archive extraction may produce: the number of entries, their total
+	// uncompressed size in bytes, and that size over the archive's. Zero
+	// disables a limit.
+	ExtractMaxEntries int
+	ExtractMaxBytes   int
+	ExtractMaxRatio   float64
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout configure
+	// the HTTP server. Zero means no timeout.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownDelay is how long the server keeps serving with readiness
+	// failing before it stops accepting connections, so load balancers can
+	// take it out of rotation. ShutdownTimeout bounds the wait for in-flight
+	// requests after that.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+	// ReadyMinFreeBytes and ReadyMinFreeInodes are the free space and inodes
+	// the workspace volume needs for /readyz to pass. envInt refuses negative
+	// values, so both convert to uint64 safely.
+	ReadyMinFreeBytes  int
+	ReadyMinFreeInodes int
+	// MetricsEnabled serves Prometheus metrics on /metrics, by default when
+	// MetricsToken is set. MetricsToken, when set, is the bearer token
+	// scrapers must present; without one /metrics is open.
+	MetricsEnabled bool
+	MetricsToken   string
+	// MetricsPerUser adds storage gauges labelled by user ID for the
+	// MetricsPerUserTop users storing the most bytes.
+	MetricsPerUser    bool
+	MetricsPerUserTop int
+	// OTLPEndpoint is the OTLP/HTTP collector traces are exported to, e.g.
+	// http://localhost:4318. Empty disables tracing. TraceSampleRatio is the
+	// fraction of traces started here that are recorded.
+	OTLPEndpoint     string
+	TraceSampleRatio float64
+	// LogLevel is the minimum level of JSON log lines: debug, info, warn or
+	// error.
+	LogLevel slog.Level
 }
 
 func Load() (*Config, error) {
@@ -42,13 +143,334 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	services := make(map[string]bool, len(tokens))
+	for _, name := range tokens {
+		services[name] = true
+	}
+	policies, err := parseScopes(os.Getenv("VFS_SERVICE_SCOPES"), services)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsHistory, err := envInt("VFS_EVENTS_HISTORY", 1024)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsWatch, err := envBool("VFS_EVENTS_WATCH", false)
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir := os.Getenv("VFS_DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
+	webhookMaxAttempts, err := envInt("VFS_WEBHOOK_MAX_ATTEMPTS", 8)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookAllowPrivate, err := envBool("VFS_WEBHOOK_ALLOW_PRIVATE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	auditMaxBytes, err := envInt("VFS_AUDIT_MAX_BYTES", 64<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	auditMaxFiles, err := envInt("VFS_AUDIT_MAX_FILES", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	auditSyncInterval, err := envDuration("VFS_AUDIT_SYNC_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var userTokenSecrets [][]byte
+	for _, secret := range splitList(os.Getenv("VFS_USER_TOKEN_SECRETS")) {
+		userTokenSecrets = append(userTokenSecrets, []byte(secret))
+	}
+
+	var userTokenKeys []ed25519.PublicKey
+	for _, raw := range splitList(os.Getenv("VFS_USER_TOKEN_ED25519_KEYS")) {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("VFS_USER_TOKEN_ED25519_KEYS must be base64 Ed25519 public keys")
+		}
+		userTokenKeys = append(userTokenKeys, ed25519.PublicKey(key))
+	}
+
+	userTokenRequired, err := envBool("VFS_USER_TOKEN_REQUIRED", false)
+	if err != nil {
+		return nil, err
+	}
+	if userTokenRequired && len(userTokenSecrets) == 0 && len(userTokenKeys) == 0 {
+		return nil, fmt.Errorf("VFS_USER_TOKEN_REQUIRED needs VFS_USER_TOKEN_SECRETS or VFS_USER_TOKEN_ED25519_KEYS")
+	}
+
+	userTokenMaxTTL, err := envDuration("VFS_USER_TOKEN_MAX_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaSoftBytes, err := envInt("VFS_QUOTA_SOFT_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaHardBytes, err := envInt("VFS_QUOTA_HARD_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaSoftFiles, err := envInt("VFS_QUOTA_SOFT_FILES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaHardFiles, err := envInt("VFS_QUOTA_HARD_FILES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaReconcileInterval, err := envDuration("VFS_QUOTA_RECONCILE_INTERVAL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	rateReadPerSec, err := envFloat("VFS_RATE_READ_PER_SEC", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	rateReadBurst, err := envInt("VFS_RATE_READ_BURST", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	rateWritePerSec, err := envFloat("VFS_RATE_WRITE_PER_SEC", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	rateWriteBurst, err := envInt("VFS_RATE_WRITE_BURST", 20)
+	if err != nil {
+		return nil, err
+	}
+
+	maxJSONBody, err := envInt("VFS_MAX_JSON_BODY", 16<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBinaryBody, err := envInt("VFS_MAX_BINARY_BODY", 256<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	extractMaxEntries, err := envInt("VFS_EXTRACT_MAX_ENTRIES", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	extractMaxBytes, err := envInt("VFS_EXTRACT_MAX_BYTES", 1<<30)
+	if err != nil {
+		return nil, err
+	}
+
+	extractMaxRatio, err := envFloat("VFS_EXTRACT_MAX_RATIO", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	readHeaderTimeout, err := envDuration("VFS_READ_HEADER_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	readTimeout, err := envDuration("VFS_READ_TIMEOUT", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	writeTimeout, err := envDuration("VFS_WRITE_TIMEOUT", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	idleTimeout, err := envDuration("VFS_IDLE_TIMEOUT", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownDelay, err := envDuration("VFS_SHUTDOWN_DELAY", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownTimeout, err := envDuration("VFS_SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	readyMinFreeBytes, err := envInt("VFS_READY_MIN_FREE_BYTES", 256<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	readyMinFreeInodes, err := envInt("VFS_READY_MIN_FREE_INODES", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	// Metrics name routes and lock activity, so they are off unless asked
+	// for; setting a token enables them.
+	metricsToken := os.Getenv("VFS_METRICS_TOKEN")
+	metricsEnabled, err := envBool("VFS_METRICS_ENABLED", metricsToken != "")
+	if err != nil {
+		return nil, err
+	}
+
+	metricsPerUser, err := envBool("VFS_METRICS_PER_USER", false)
+	if err != nil {
+		return nil, err
+	}
+
+	metricsPerUserTop, err := envInt("VFS_METRICS_PER_USER_TOP", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	traceSampleRatio, err := envFloat("VFS_TRACE_SAMPLE_RATIO", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var logLevel slog.Level
+	if raw := os.Getenv("VFS_LOG_LEVEL"); raw != "" {
+		if err := logLevel.UnmarshalText([]byte(raw)); err != nil {
+			return nil, fmt.Errorf("VFS_LOG_LEVEL must be debug, info, warn or error")
+		}
+	}
+
 	return &Config{
-		Port:          port,
-		WorkspaceBase: base,
-		ServiceTokens: tokens,
+		Port:                   port,
+		WorkspaceBase:          base,
+		ServiceTokens:          tokens,
+		ServicePolicies:        policies,
+		EventsHistory:          eventsHistory,
+		EventsWatch:            eventsWatch,
+		DataDir:                dataDir,
+		WebhookMaxAttempts:     webhookMaxAttempts,
+		WebhookAllowPrivate:    webhookAllowPrivate,
+		AuditMaxBytes:          auditMaxBytes,
+		AuditMaxFiles:          auditMaxFiles,
+		AuditSyncInterval:      auditSyncInterval,
+		UserTokenSecrets:       userTokenSecrets,
+		UserTokenPublicKeys:    userTokenKeys,
+		UserTokenRequired:      userTokenRequired,
+		UserTokenMaxTTL:        userTokenMaxTTL,
+		UserIDPolicy:           os.Getenv("VFS_USER_ID_POLICY"),
+		UserIDPattern:          os.Getenv("VFS_USER_ID_PATTERN"),
+		UserDirLayout:          os.Getenv("VFS_USER_DIR_LAYOUT"),
+		QuotaSoftBytes:         quotaSoftBytes,
+		QuotaHardBytes:         quotaHardBytes,
+		QuotaSoftFiles:         quotaSoftFiles,
+		QuotaHardFiles:         quotaHardFiles,
+		QuotaReconcileInterval: quotaReconcileInterval,
+		RateReadPerSec:         rateReadPerSec,
+		RateReadBurst:          rateReadBurst,
+		RateWritePerSec:        rateWritePerSec,
+		RateWriteBurst:         rateWriteBurst,
+		MaxJSONBody:            maxJSONBody,
+		MaxBinaryBody:          maxBinaryBody,
+		ExtractMaxEntries:      extractMaxEntries,
+		ExtractMaxBytes:        extractMaxBytes,
+		ExtractMaxRatio:        extractMaxRatio,
+		ReadHeaderTimeout:      readHeaderTimeout,
+		ReadTimeout:            readTimeout,
+		WriteTimeout:           writeTimeout,
+		IdleTimeout:            idleTimeout,
+		ShutdownDelay:          shutdownDelay,
+		ShutdownTimeout:        shutdownTimeout,
+		ReadyMinFreeBytes:      readyMinFreeBytes,
+		ReadyMinFreeInodes:     readyMinFreeInodes,
+		MetricsEnabled:         metricsEnabled,
+		MetricsToken:           metricsToken,
+		MetricsPerUser:         metricsPerUser,
+		MetricsPerUserTop:      metricsPerUserTop,
+		OTLPEndpoint:           os.Getenv("VFS_OTLP_ENDPOINT"),
+		TraceSampleRatio:       traceSampleRatio,
+		LogLevel:               logLevel,
 	}, nil
 }
 
+func envInt(name string, fallback int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return v, nil
+}
+
+func envFloat(name string, fallback float64) (float64, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number", name)
+	}
+	return v, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration", name)
+	}
+	return v, nil
+}
+
+// splitList splits a comma-separated value, dropping empty items.
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func envBool(name string, fallback bool) (bool, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean", name)
+	}
+	return v, nil
+}
+
 // parseTokens parses "webapp:token1,agent:token2" into map[token]serviceName.
 func parseTokens(raw string) (map[string]string, error) {
 	m := make(map[string]string)
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{"defaults", nil, "", func(t *testing.T, cfg *Config) {
+			if cfg.Port != "8090" || cfg.ReadyMinFreeBytes != 256<<20 || cfg.ReadyMinFreeInodes != 10000 {
+				t.Errorf("unexpected defaults: port %q, free bytes %d, free inodes %d", cfg.Port, cfg.ReadyMinFreeBytes, cfg.ReadyMinFreeInodes)
+			}
+		}},
+		{"ready thresholds", map[string]string{"VFS_READY_MIN_FREE_BYTES": "42", "VFS_READY_MIN_FREE_INODES": "0"}, "", func(t *testing.T, cfg *Config) {
+			if cfg.ReadyMinFreeBytes != 42 || cfg.ReadyMinFreeInodes != 0 {
+				t.Errorf("got free bytes %d, free inodes %d", cfg.ReadyMinFreeBytes, cfg.ReadyMinFreeInodes)
+			}
+		}},
+		{"negative free bytes", map[string]string{"VFS_READY_MIN_FREE_BYTES": "-1"}, "VFS_READY_MIN_FREE_BYTES", nil},
+		{"non-numeric free bytes", map[string]string{"VFS_READY_MIN_FREE_BYTES": "lots"}, "VFS_READY_MIN_FREE_BYTES", nil},
+		{"negative free inodes", map[string]string{"VFS_READY_MIN_FREE_INODES": "-1"}, "VFS_READY_MIN_FREE_INODES", nil},
+		{"non-numeric free inodes", map[string]string{"VFS_READY_MIN_FREE_INODES": "1e3"}, "VFS_READY_MIN_FREE_INODES", nil},
+		{"missing workspace base", map[string]string{"VFS_WORKSPACE_BASE": ""}, "VFS_WORKSPACE_BASE", nil},
+		{"missing service tokens", map[string]string{"VFS_SERVICE_TOKENS": ""}, "VFS_SERVICE_TOKENS", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOENV", "production")
+			t.Setenv("VFS_WORKSPACE_BASE", t.TempDir())
+			t.Setenv("VFS_SERVICE_TOKENS", "agent:secret")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error naming %s, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
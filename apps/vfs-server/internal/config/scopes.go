@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Scopes a service token can be granted.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeDelete = "delete"
+	ScopeAdmin  = "admin"
+)
+
+// Policy restricts what a service may do.
+type Policy struct {
+	Scopes map[string]bool
+	// PathPrefixes, when non-empty, limits the service to these
+	// workspace-relative subtrees.
+	PathPrefixes []string
+}
+
+// DefaultPolicy applies to services without an entry in VFS_SERVICE_SCOPES and
+// matches the access every token had before scopes existed.
+func DefaultPolicy() Policy {
+	return Policy{Scopes: map[string]bool{ScopeRead: true, ScopeWrite: true, ScopeDelete: true}}
+}
+
+// Has reports whether the policy grants scope.
+func (p Policy) Has(scope string) bool {
+	return p.Scopes[scope]
+}
+
+// AllowsPath reports whether the workspace-relative path p is inside one of
+// the policy's prefixes. Paths are cleaned the same way the handlers resolve
+// them, so "a/../b" is checked as "b".
+func (p Policy) AllowsPath(workspacePath string) bool {
+	if len(p.PathPrefixes) == 0 {
+		return true
+	}
+	cleaned := CleanWorkspacePath(workspacePath)
+	for _, prefix := range p.PathPrefixes {
+		if cleaned == prefix || strings.HasPrefix(cleaned, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanWorkspacePath normalises a client-supplied path to the
+// slash-separated, root-relative form ("" for the workspace root).
+func CleanWorkspacePath(p string) string {
+	p = strings.TrimPrefix(strings.TrimSpace(p), "/")
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// parseScopes parses "memory:read+write:.threads/|.memory/,agent:read+write"
+// into map[serviceName]Policy. The prefix list is optional.
+func parseScopes(raw string, services map[string]bool) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid service scope entry: %q", entry)
+		}
+		service := parts[0]
+		if !services[service] {
+			return nil, fmt.Errorf("scopes configured for unknown service %q", service)
+		}
+		if _, dup := policies[service]; dup {
+			return nil, fmt.Errorf("duplicate scopes for service %q", service)
+		}
+
+		policy := Policy{Scopes: make(map[string]bool)}
+		for _, scope := range strings.Split(parts[1], "+") {
+			switch scope {
+			case ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin:
+				policy.Scopes[scope] = true
+			default:
+				return nil, fmt.Errorf("unknown scope %q for service %q", scope, service)
+			}
+		}
+
+		if len(parts) == 3 {
+			for _, prefix := range strings.Split(parts[2], "|") {
+				prefix = CleanWorkspacePath(prefix)
+				if prefix == "" {
+					return nil, fmt.Errorf("empty path prefix for service %q", service)
+				}
+				policy.PathPrefixes = append(policy.PathPrefixes, prefix)
+			}
+		}
+
+		policies[service] = policy
+	}
+	return policies, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import "testing"
+
+func TestParseScopes(t *testing.T) {
+	services := map[string]bool{"memory": true, "agent": true, "webapp": true}
+
+	policies, err := parseScopes("memory:read+write:.threads/|/notes, agent:read+write+delete", services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := policies["memory"]
+	if !memory.Has(ScopeRead) || !memory.Has(ScopeWrite) || memory.Has(ScopeDelete) {
+		t.Fatalf("unexpected memory scopes: %+v", memory.Scopes)
+	}
+	if len(memory.PathPrefixes) != 2 || memory.PathPrefixes[0] != ".threads" || memory.PathPrefixes[1] != "notes" {
+		t.Fatalf("unexpected memory prefixes: %q", memory.PathPrefixes)
+	}
+
+	if _, ok := policies["webapp"]; ok {
+		t.Fatal("expected webapp to fall back to the default policy")
+	}
+}
+
+func TestParseScopesErrors(t *testing.T) {
+	services := map[string]bool{"memory": true}
+	tests := map[string]string{
+		"unknown service": "ghost:read",
+		"unknown scope":   "memory:read+fly",
+		"missing scopes":  "memory",
+		"empty prefix":    "memory:read:/",
+		"duplicate":       "memory:read,memory:write",
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseScopes(raw, services); err == nil {
+				t.Fatalf("expected error for %q", raw)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowsPath(t *testing.T) {
+	p := Policy{PathPrefixes: []string{".threads"}}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{".threads", true},
+		{".threads/t1.json", true},
+		{"/.threads/t1.json", true},
+		{".threadsx/t1.json", false},
+		{".threads/../secret.txt", false},
+		{"", false},
+		{"docs/a.txt", false},
+	}
+	for _, tt := range tests {
+		if got := p.AllowsPath(tt.path); got != tt.want {
+			t.Errorf("AllowsPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if !DefaultPolicy().AllowsPath("anything/at/all") {
+		t.Error("expected the default policy to allow every path")
+	}
+}
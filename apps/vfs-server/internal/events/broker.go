@@ -0,0 +1,246 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types emitted for workspace changes.
+const (
+	TypeCreate = "create"
+	TypeModify = "modify"
+	TypeDelete = "delete"
+	TypeRename = "rename"
+)
+
+// Event sources.
+const (
+	SourceAPI     = "api"
+	SourceWatcher = "watcher"
+)
+
+// Event describes a single change inside a user's workspace. Paths are
+// workspace-relative and use forward slashes.
+type Event struct {
+	ID          uint64    `json:"id"`
+	Type        string    `json:"type"`
+	UserID      string    `json:"-"`
+	Service     string    `json:"service,omitempty"`
+	Path        string    `json:"path"`
+	OldPath     string    `json:"oldPath,omitempty"`
+	IsDirectory bool      `json:"isDirectory"`
+	Source      string    `json:"source"`
+	Time        time.Time `json:"time"`
+}
+
+// Matches reports whether the event touches prefix or anything below it.
+func (e Event) Matches(prefix string) bool {
+	_, ok := e.Scoped(prefix)
+	return ok
+}
+
+// Scoped returns the event as seen by a subscriber limited to prefix. A
+// rename that crosses the prefix boundary is reported as a create or a
+// delete of the side inside it, so the path outside the prefix never
+// leaks. ok is false when the event does not touch prefix at all.
+func (e Event) Scoped(prefix string) (Event, bool) {
+	in := underPrefix(e.Path, prefix)
+	if e.OldPath == "" {
+		return e, in
+	}
+	oldIn := underPrefix(e.OldPath, prefix)
+	switch {
+	case in && oldIn:
+		return e, true
+	case in:
+		e.Type = TypeCreate
+		e.OldPath = ""
+		return e, true
+	case oldIn:
+		e.Type = TypeDelete
+		e.Path = e.OldPath
+		e.OldPath = ""
+		return e, true
+	}
+	return Event{}, false
+}
+
+// SplitFunc maps an absolute path to its owning user ID and the
+// slash-separated workspace-relative path.
+type SplitFunc func(path string) (userID, rel string, ok bool)
+
+// Subscription receives live events for one user, or for all users.
+type Subscription struct {
+	C <-chan Event
+
+	ch     chan Event
+	userID string
+	lagged bool
+}
+
+// Lagged reports whether the subscription was dropped because the consumer
+// could not keep up. The channel is closed when this happens.
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// Broker fans out workspace events to subscribers and keeps a bounded history
+// so reconnecting clients can resume from a Last-Event-ID.
+type Broker struct {
+	mu sync.Mutex
+
+	firstID uint64
+	nextID  uint64
+	history []Event
+	size    int
+	subs    map[*Subscription]struct{}
+
+	// recent remembers when each user path last produced an event so the
+	// watcher does not echo changes the handlers already reported.
+	recent map[string]time.Time
+}
+
+const (
+	subscriberBuffer = 64
+	echoWindow       = time.Second
+)
+
+// NewBroker creates a broker that retains the last historySize events.
+func NewBroker(historySize int) *Broker {
+	if historySize <= 0 {
+		historySize = 1
+	}
+	// Seeding IDs from the clock keeps them increasing across restarts, so a
+	// Last-Event-ID from a previous process is detected as stale.
+	seed := uint64(time.Now().UnixNano())
+	return &Broker{
+		firstID: seed,
+		nextID:  seed,
+		history: make([]Event, 0, historySize),
+		size:    historySize,
+		subs:    make(map[*Subscription]struct{}),
+		recent:  make(map[string]time.Time),
+	}
+}
+
+// Publish assigns an ID to e, records it and delivers it to subscribers.
+func (b *Broker) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.publishLocked(e)
+}
+
+// PublishExternal publishes an event observed outside the handlers unless the
+// same path already produced an event within the echo window.
+func (b *Broker) PublishExternal(e Event) (Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if seen, ok := b.recent[recentKey(e.UserID, e.Path)]; ok && now.Sub(seen) < echoWindow {
+		return Event{}, false
+	}
+	return b.publishLocked(e), true
+}
+
+func (b *Broker) publishLocked(e Event) Event {
+	b.nextID++
+	e.ID = b.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Source == "" {
+		e.Source = SourceAPI
+	}
+
+	if len(b.history) == b.size {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:len(b.history)-1]
+	}
+	b.history = append(b.history, e)
+
+	b.rememberLocked(e)
+
+	for sub := range b.subs {
+		if sub.userID != "" && sub.userID != e.UserID {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.lagged = true
+			b.removeLocked(sub)
+		}
+	}
+	return e
+}
+
+// Subscribe registers a subscriber for userID, or for every user when userID
+// is empty. If afterID is non-zero, the retained events newer than afterID are
+// returned for replay; complete is false when events after afterID have
+// already been evicted from history.
+func (b *Broker) Subscribe(userID string, afterID uint64) (sub *Subscription, replay []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if afterID != 0 {
+		if afterID < b.firstID || afterID > b.nextID || (len(b.history) > 0 && b.history[0].ID > afterID+1) {
+			complete = false
+		}
+		for _, e := range b.history {
+			if e.ID > afterID && (userID == "" || e.UserID == userID) {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, userID: userID}
+	b.subs[sub] = struct{}{}
+	return sub, replay, complete
+}
+
+// Unsubscribe removes sub and closes its channel. It is safe to call more
+// than once.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeLocked(sub)
+}
+
+func (b *Broker) removeLocked(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+func (b *Broker) rememberLocked(e Event) {
+	now := time.Now()
+	if len(b.recent) > 1024 {
+		for key, seen := range b.recent {
+			if now.Sub(seen) >= echoWindow {
+				delete(b.recent, key)
+			}
+		}
+	}
+	b.recent[recentKey(e.UserID, e.Path)] = now
+	if e.OldPath != "" {
+		b.recent[recentKey(e.UserID, e.OldPath)] = now
+	}
+}
+
+func recentKey(userID, path string) string {
+	return userID + "\x00" + path
+}
+
+func underPrefix(path, prefix string) bool {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" || prefix == "." {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,206 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBrokerDeliversOnlyToOwningUser(t *testing.T) {
+	b := NewBroker(16)
+	subA, _, _ := b.Subscribe("user-aaaaaaaa", 0)
+	subB, _, _ := b.Subscribe("user-bbbbbbbb", 0)
+	defer b.Unsubscribe(subA)
+	defer b.Unsubscribe(subB)
+
+	b.Publish(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "a.txt"})
+
+	select {
+	case e := <-subA.C:
+		if e.Path != "a.txt" || e.Type != TypeCreate || e.ID == 0 {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	select {
+	case e := <-subB.C:
+		t.Fatalf("other user received event %+v", e)
+	default:
+	}
+}
+
+func TestBrokerReplaysAfterLastEventID(t *testing.T) {
+	b := NewBroker(16)
+	first := b.Publish(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "a.txt"})
+	b.Publish(Event{Type: TypeCreate, UserID: "user-bbbbbbbb", Path: "b.txt"})
+	third := b.Publish(Event{Type: TypeModify, UserID: "user-aaaaaaaa", Path: "a.txt"})
+
+	sub, replay, complete := b.Subscribe("user-aaaaaaaa", first.ID)
+	defer b.Unsubscribe(sub)
+
+	if !complete {
+		t.Fatal("expected complete replay")
+	}
+	if len(replay) != 1 || replay[0].ID != third.ID {
+		t.Fatalf("expected replay of event %d only, got %+v", third.ID, replay)
+	}
+}
+
+func TestBrokerReportsEvictedHistory(t *testing.T) {
+	b := NewBroker(2)
+	first := b.Publish(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "1"})
+	b.Publish(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "2"})
+	b.Publish(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "3"})
+	b.Publish(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "4"})
+
+	sub, replay, complete := b.Subscribe("user-aaaaaaaa", first.ID)
+	defer b.Unsubscribe(sub)
+
+	if complete {
+		t.Fatal("expected incomplete replay after eviction")
+	}
+	if len(replay) != 2 {
+		t.Fatalf("expected the 2 retained events, got %d", len(replay))
+	}
+}
+
+func TestBrokerRejectsUnknownLastEventID(t *testing.T) {
+	b := NewBroker(4)
+	sub, _, complete := b.Subscribe("user-aaaaaaaa", 42)
+	defer b.Unsubscribe(sub)
+
+	if complete {
+		t.Fatal("expected an ID from before this process to be reported as incomplete")
+	}
+}
+
+func TestBrokerDropsLaggingSubscriber(t *testing.T) {
+	b := NewBroker(4)
+	sub, _, _ := b.Subscribe("user-aaaaaaaa", 0)
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Publish(Event{Type: TypeModify, UserID: "user-aaaaaaaa", Path: "a.txt"})
+	}
+
+	for range sub.C {
+	}
+	if !sub.Lagged() {
+		t.Fatal("expected subscriber to be marked as lagged")
+	}
+	b.Unsubscribe(sub)
+}
+
+func TestBrokerSuppressesExternalEcho(t *testing.T) {
+	b := NewBroker(4)
+	b.Publish(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "a.txt"})
+
+	if _, ok := b.PublishExternal(Event{Type: TypeModify, UserID: "user-aaaaaaaa", Path: "a.txt"}); ok {
+		t.Fatal("expected watcher echo of an API change to be suppressed")
+	}
+	if _, ok := b.PublishExternal(Event{Type: TypeCreate, UserID: "user-aaaaaaaa", Path: "b.txt"}); !ok {
+		t.Fatal("expected unrelated external change to be published")
+	}
+}
+
+func TestEventMatchesPrefix(t *testing.T) {
+	tests := []struct {
+		event  Event
+		prefix string
+		want   bool
+	}{
+		{Event{Path: "docs/a.txt"}, "", true},
+		{Event{Path: "docs/a.txt"}, ".", true},
+		{Event{Path: "docs/a.txt"}, "docs", true},
+		{Event{Path: "docs"}, "docs", true},
+		{Event{Path: "docsx/a.txt"}, "docs", false},
+		{Event{Path: "other/a.txt", OldPath: "docs/a.txt"}, "docs", true},
+	}
+	for _, tt := range tests {
+		if got := tt.event.Matches(tt.prefix); got != tt.want {
+			t.Errorf("%+v.Matches(%q) = %v, want %v", tt.event, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestEventScopedRenameAcrossPrefix(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  Event
+	}{
+		{
+			"moved out",
+			Event{Type: TypeRename, Path: "other/a.txt", OldPath: "docs/a.txt"},
+			Event{Type: TypeDelete, Path: "docs/a.txt"},
+		},
+		{
+			"moved in",
+			Event{Type: TypeRename, Path: "docs/a.txt", OldPath: "other/a.txt"},
+			Event{Type: TypeCreate, Path: "docs/a.txt"},
+		},
+		{
+			"within prefix",
+			Event{Type: TypeRename, Path: "docs/b.txt", OldPath: "docs/a.txt"},
+			Event{Type: TypeRename, Path: "docs/b.txt", OldPath: "docs/a.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.event.Scoped("docs")
+			if !ok || got != tt.want {
+				t.Fatalf("Scoped = %+v, %v; want %+v", got, ok, tt.want)
+			}
+		})
+	}
+
+	if _, ok := (Event{Type: TypeRename, Path: "x/b", OldPath: "y/a"}).Scoped("docs"); ok {
+		t.Fatal("expected rename outside the prefix to be dropped")
+	}
+}
+
+func TestWatcherPublishesOutOfBandChanges(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("watcher requires inotify")
+	}
+
+	base := t.TempDir()
+	userDir := filepath.Join(base, "user-aaaaaaaa")
+	if err := os.MkdirAll(userDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBroker(16)
+	split := func(path string) (string, string, bool) {
+		rel, err := filepath.Rel(userDir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return "", "", false
+		}
+		return "user-aaaaaaaa", filepath.ToSlash(rel), true
+	}
+	w, err := NewWatcher(base, split, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	sub, _, _ := b.Subscribe("user-aaaaaaaa", 0)
+	defer b.Unsubscribe(sub)
+
+	if err := os.WriteFile(filepath.Join(userDir, "notes.txt"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-sub.C:
+		if e.Path != "notes.txt" || e.Source != SourceWatcher {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for watcher event")
+	}
+}
@@ -0,0 +1,217 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_ONLYDIR
+
+// Watcher publishes changes made to the workspace outside the HTTP handlers
+// (for example by a sandbox sharing the volume) using inotify.
+type Watcher struct {
+	base   string
+	split  SplitFunc
+	broker *Broker
+
+	fd   int
+	file *os.File
+
+	mu   sync.Mutex
+	dirs map[int]string
+}
+
+// NewWatcher starts watching every directory below workspaceBase, using split
+// to attribute changed paths to users.
+func NewWatcher(workspaceBase string, split SplitFunc, broker *Broker) (*Watcher, error) {
+	// A non-blocking descriptor wrapped in an *os.File goes through the
+	// runtime poller, so Close unblocks a pending Read.
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+
+	w := &Watcher{
+		base:   filepath.Clean(workspaceBase),
+		split:  split,
+		broker: broker,
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int]string),
+	}
+	if err := w.addTree(w.base); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Close stops the watcher.
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *Watcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Directories can vanish while we walk them.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return w.addWatch(path)
+	})
+}
+
+func (w *Watcher) addWatch(dir string) error {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+			return nil
+		}
+		return fmt.Errorf("inotify watch %s: %w", dir, err)
+	}
+	// Re-adding a watched inode returns its existing descriptor, which also
+	// refreshes the path of directories that were moved.
+	w.mu.Lock()
+	w.dirs[wd] = dir
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *Watcher) forget(wd int) {
+	w.mu.Lock()
+	delete(w.dirs, wd)
+	w.mu.Unlock()
+}
+
+func (w *Watcher) dirFor(wd int) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dir, ok := w.dirs[wd]
+	return dir, ok
+}
+
+type pendingMove struct {
+	path  string
+	isDir bool
+}
+
+func (w *Watcher) run() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("events: watcher stopped: %v", err)
+			}
+			return
+		}
+		if n < unix.SizeofInotifyEvent {
+			continue
+		}
+
+		moves := make(map[uint32]pendingMove)
+		var order []uint32
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(raw.Len)]
+			offset += unix.SizeofInotifyEvent + int(raw.Len)
+
+			if raw.Mask&unix.IN_IGNORED != 0 {
+				w.forget(int(raw.Wd))
+				continue
+			}
+			if raw.Mask&unix.IN_DELETE_SELF != 0 {
+				continue
+			}
+
+			dir, ok := w.dirFor(int(raw.Wd))
+			if !ok {
+				continue
+			}
+			name := strings.TrimRight(string(nameBytes), "\x00")
+			if name == "" {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			isDir := raw.Mask&unix.IN_ISDIR != 0
+
+			switch {
+			case raw.Mask&unix.IN_CREATE != 0:
+				if isDir {
+					if err := w.addTree(path); err != nil {
+						log.Printf("events: %v", err)
+					}
+				}
+				w.emit(TypeCreate, path, "", isDir)
+			case raw.Mask&unix.IN_CLOSE_WRITE != 0:
+				w.emit(TypeModify, path, "", false)
+			case raw.Mask&unix.IN_DELETE != 0:
+				w.emit(TypeDelete, path, "", isDir)
+			case raw.Mask&unix.IN_MOVED_FROM != 0:
+				moves[raw.Cookie] = pendingMove{path: path, isDir: isDir}
+				order = append(order, raw.Cookie)
+			case raw.Mask&unix.IN_MOVED_TO != 0:
+				if isDir {
+					if err := w.addTree(path); err != nil {
+						log.Printf("events: %v", err)
+					}
+				}
+				if from, ok := moves[raw.Cookie]; ok {
+					delete(moves, raw.Cookie)
+					w.emit(TypeRename, path, from.path, isDir)
+				} else {
+					w.emit(TypeCreate, path, "", isDir)
+				}
+			}
+		}
+
+		// A move without a matching destination left the watched tree.
+		for _, cookie := range order {
+			if from, ok := moves[cookie]; ok {
+				w.emit(TypeDelete, from.path, "", from.isDir)
+			}
+		}
+	}
+}
+
+func (w *Watcher) emit(eventType, path, oldPath string, isDir bool) {
+	userID, rel, ok := w.split(path)
+	if !ok {
+		return
+	}
+	e := Event{
+		Type:        eventType,
+		UserID:      userID,
+		Path:        rel,
+		IsDirectory: isDir,
+		Source:      SourceWatcher,
+	}
+	if oldPath != "" {
+		oldUser, oldRel, ok := w.split(oldPath)
+		if !ok || oldUser != userID {
+			e.Type = TypeCreate
+		} else {
+			e.OldPath = oldRel
+		}
+	}
+	w.broker.PublishExternal(e)
+}
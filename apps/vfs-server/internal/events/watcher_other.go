@@ -0,0 +1,18 @@
+//go:build !linux
+
+package events
+
+import "errors"
+
+// Watcher is only implemented on Linux.
+type Watcher struct{}
+
+// NewWatcher reports that out-of-band change detection is unavailable.
+func NewWatcher(string, SplitFunc, *Broker) (*Watcher, error) {
+	return nil, errors.New("workspace watcher requires inotify (linux only)")
+}
+
+// Close is a no-op.
+func (w *Watcher) Close() error {
+	return nil
+}
@@ -0,0 +1,241 @@
+package fsops
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Archive formats WriteArchive produces.
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ArchiveStats counts what went into an archive.
+type ArchiveStats struct {
+	Files    int
+	Dirs     int
+	Symlinks int
+	// Bytes is the uncompressed size of the files.
+	Bytes int64
+}
+
+// archiveWriter adds entries to one archive format. Names are
+// slash-separated and relative to the archive root.
+type archiveWriter interface {
+	dir(name string, info os.FileInfo) error
+	file(name string, info os.FileInfo, content io.Reader) error
+	symlink(name string, info os.FileInfo, target string) error
+	Close() error
+}
+
+// WriteArchive streams the file or directory tree at name to w in format,
+// with entries under prefix. Symlinks are stored as links, not followed, and
+// entries that are neither files, directories nor links are skipped. Only
+// one file is open at a time, so memory use does not grow with the tree.
+//
+// On error the archive is left unfinished, so a reader sees it is truncated
+// rather than taking it for the whole tree.
+func WriteArchive(w io.Writer, r *Root, name, prefix, format string, filter *GlobFilter) (ArchiveStats, error) {
+	var aw archiveWriter
+	switch format {
+	case ArchiveZip:
+		aw = &zipArchive{zw: zip.NewWriter(w)}
+	default:
+		gz := gzip.NewWriter(w)
+		aw = &tarArchive{gz: gz, tw: tar.NewWriter(gz)}
+	}
+
+	a := &archiver{root: r, aw: aw, filter: filter}
+	info, err := r.Lstat(name)
+	if err != nil {
+		return a.stats, err
+	}
+	if err := a.add(name, "", prefix, info); err != nil {
+		return a.stats, err
+	}
+	return a.stats, aw.Close()
+}
+
+type archiver struct {
+	root   *Root
+	aw     archiveWriter
+	filter *GlobFilter
+	stats  ArchiveStats
+}
+
+// add writes the entry at name, whose path relative to the archived tree is
+// rel and whose entry name is entry, descending into directories.
+func (a *archiver) add(name, rel, entry string, info os.FileInfo) error {
+	switch {
+	case info.IsDir():
+		if rel != "" && a.filter.Excluded(rel) {
+			return nil
+		}
+		// With include patterns only the directories leading to matched
+		// files appear, as the files' parents.
+		if len(a.filter.Include) == 0 {
+			if err := a.aw.dir(entry, info); err != nil {
+				return err
+			}
+			a.stats.Dirs++
+		}
+		entries, err := a.root.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			child := filepath.Join(name, e.Name())
+			childInfo, err := a.root.Lstat(child)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := a.add(child, path.Join(rel, e.Name()), path.Join(entry, e.Name()), childInfo); err != nil {
+				return err
+			}
+		}
+	case rel != "" && !a.filter.Included(rel):
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := a.root.Readlink(name)
+		if err != nil {
+			return err
+		}
+		if err := a.aw.symlink(entry, info, filepath.ToSlash(target)); err != nil {
+			return err
+		}
+		a.stats.Symlinks++
+	case info.Mode().IsRegular():
+		f, err := a.root.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := a.aw.file(entry, info, f); err != nil {
+			return err
+		}
+		a.stats.Files++
+		a.stats.Bytes += info.Size()
+	}
+	return nil
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (z *zipArchive) header(name string, info os.FileInfo) (*zip.FileHeader, error) {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = name
+	return hdr, nil
+}
+
+func (z *zipArchive) dir(name string, info os.FileInfo) error {
+	hdr, err := z.header(name+"/", info)
+	if err != nil {
+		return err
+	}
+	_, err = z.zw.CreateHeader(hdr)
+	return err
+}
+
+func (z *zipArchive) file(name string, info os.FileInfo, content io.Reader) error {
+	hdr, err := z.header(name, info)
+	if err != nil {
+		return err
+	}
+	hdr.Method = zip.Deflate
+	fw, err := z.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, content)
+	return err
+}
+
+// symlink stores the link target as the entry's content, with the link
+// mode in the external attributes, as Info-ZIP does.
+func (z *zipArchive) symlink(name string, info os.FileInfo, target string) error {
+	hdr, err := z.header(name, info)
+	if err != nil {
+		return err
+	}
+	fw, err := z.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(fw, target)
+	return err
+}
+
+func (z *zipArchive) Close() error {
+	return z.zw.Close()
+}
+
+type tarArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+// header builds a tar header without the server's user and group, which
+// mean nothing to whoever extracts the archive.
+func (t *tarArchive) header(name string, info os.FileInfo, link string) (*tar.Header, error) {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = name
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	return hdr, nil
+}
+
+func (t *tarArchive) dir(name string, info os.FileInfo) error {
+	hdr, err := t.header(name+"/", info, "")
+	if err != nil {
+		return err
+	}
+	return t.tw.WriteHeader(hdr)
+}
+
+// file copies exactly the size in the header; a file that shrank since it
+// was listed fails rather than producing a corrupt entry.
+func (t *tarArchive) file(name string, info os.FileInfo, content io.Reader) error {
+	hdr, err := t.header(name, info, "")
+	if err != nil {
+		return err
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(t.tw, content, hdr.Size)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (t *tarArchive) symlink(name string, info os.FileInfo, target string) error {
+	hdr, err := t.header(name, info, target)
+	if err != nil {
+		return err
+	}
+	return t.tw.WriteHeader(hdr)
+}
+
+func (t *tarArchive) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
@@ -0,0 +1,144 @@
+package fsops
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.log", "a.log", true},
+		{"*.log", "deep/dir/a.log", true},
+		{"node_modules", "web/node_modules", true},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"docs/**/*.md", "docs/sub/deep/a.md", true},
+		{"docs/**/*.md", "docs/a.md", true},
+		{"src/**", "src", true},
+		{"./src/", "src", true},
+		{"src/**", "srcs/a", false},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+
+	if err := (&GlobFilter{Exclude: []string{"a/[b"}}).Validate(); err == nil {
+		t.Error("expected malformed pattern to fail validation")
+	}
+}
+
+func newArchiveRoot(t *testing.T) *Root {
+	t.Helper()
+	root, _ := newTestRoot(t)
+	base := root.Path()
+	for name, content := range map[string]string{
+		"docs/b.log":            "log",
+		"node_modules/pkg/x.js": "js",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(base, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(base, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestWriteArchiveTarGz(t *testing.T) {
+	root := newArchiveRoot(t)
+
+	var buf bytes.Buffer
+	filter := &GlobFilter{Exclude: []string{"node_modules", "*.log"}}
+	stats, err := WriteArchive(&buf, root, root.Path(), "ws", ArchiveTarGz, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		switch hdr.Name {
+		case "ws/docs/a.txt":
+			if data, _ := io.ReadAll(tr); string(data) != "hello" {
+				t.Errorf("a.txt: got %q", data)
+			}
+		case "ws/escape":
+			// Links are stored, not followed out of the workspace.
+			if hdr.Typeflag != tar.TypeSymlink {
+				t.Errorf("escape: expected a symlink entry, got type %c", hdr.Typeflag)
+			}
+		}
+	}
+	want := []string{"ws/", "ws/docs/", "ws/docs/a.txt", "ws/docs/secret-link", "ws/escape"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("entries: got %v, want %v", names, want)
+	}
+	if stats.Files != 1 || stats.Dirs != 2 || stats.Symlinks != 2 || stats.Bytes != 5 {
+		t.Errorf("stats: got %+v", stats)
+	}
+}
+
+func TestWriteArchiveZipInclude(t *testing.T) {
+	root := newArchiveRoot(t)
+
+	var buf bytes.Buffer
+	filter := &GlobFilter{Include: []string{"**/*.js", "docs/*.txt"}}
+	if _, err := WriteArchive(&buf, root, root.Path(), "ws", ArchiveZip, filter); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"ws/docs/a.txt", "ws/node_modules/pkg/x.js"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("entries: got %v, want %v", names, want)
+	}
+}
+
+func TestWriteArchiveSingleFile(t *testing.T) {
+	root := newArchiveRoot(t)
+
+	var buf bytes.Buffer
+	if _, err := WriteArchive(&buf, root, filepath.Join(root.Path(), "docs", "a.txt"), "a.txt", ArchiveZip, &GlobFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "a.txt" {
+		t.Fatalf("got %d entries", len(zr.File))
+	}
+}
@@ -0,0 +1,81 @@
+package fsops
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Hash algorithms the hash endpoint computes and uploads can be checked
+// against.
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashMD5    = "md5"
+	HashBLAKE3 = "blake3"
+)
+
+// ErrChecksumMismatch is returned by VerifyChecksum when content does not
+// match a digest the client sent with it.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// NewHash returns a hash for algo, or false if the algorithm is unknown.
+func NewHash(algo string) (hash.Hash, bool) {
+	switch algo {
+	case HashSHA256:
+		return sha256.New(), true
+	case HashSHA512:
+		return sha512.New(), true
+	case HashMD5:
+		return md5.New(), true
+	case HashBLAKE3:
+		return blake3.New(32, nil), true
+	}
+	return nil, false
+}
+
+// Checksum is a digest a client expects some content to have.
+type Checksum struct {
+	Algo string
+	Sum  []byte
+}
+
+// ParseChecksum reads the expected digest of an upload from an X-Checksum
+// header of the form "algo:hex", as the hash endpoint reports it. The header
+// describes the file being written, not the request body, which is why it is
+// not sent as an RFC 9530 Content-Digest. ok is false when the header is
+// empty.
+func ParseChecksum(header string) (c Checksum, ok bool, err error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return Checksum{}, false, nil
+	}
+	algo, digest, found := strings.Cut(header, ":")
+	algo = strings.ToLower(algo)
+	if _, known := NewHash(algo); !found || !known {
+		return Checksum{}, false, fmt.Errorf("invalid X-Checksum; expected sha256, sha512, md5 or blake3 as algo:hex")
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return Checksum{}, false, fmt.Errorf("invalid X-Checksum; expected sha256, sha512, md5 or blake3 as algo:hex")
+	}
+	return Checksum{Algo: algo, Sum: sum}, true, nil
+}
+
+// VerifyChecksum checks data against c.
+func VerifyChecksum(data []byte, c Checksum) error {
+	h, _ := NewHash(c.Algo)
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), c.Sum) {
+		return fmt.Errorf("%w: content does not match %s digest", ErrChecksumMismatch, c.Algo)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package fsops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestNewHash(t *testing.T) {
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{HashSHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{HashMD5, "5d41402abc4b2a76b9719d911017c592"},
+		{HashBLAKE3, "ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f"},
+	}
+	for _, tt := range tests {
+		h, ok := NewHash(tt.algo)
+		if !ok {
+			t.Fatalf("%s: not supported", tt.algo)
+		}
+		h.Write([]byte("hello"))
+		if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.algo, got, tt.want)
+		}
+	}
+	if _, ok := NewHash("crc32"); ok {
+		t.Error("crc32: expected unsupported")
+	}
+}
+
+func TestParseAndVerifyChecksum(t *testing.T) {
+	data := []byte("hello")
+	sum := sha256.Sum256(data)
+
+	c, ok, err := ParseChecksum("SHA256:" + hex.EncodeToString(sum[:]))
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v", ok, err)
+	}
+	if c.Algo != HashSHA256 {
+		t.Fatalf("got %+v", c)
+	}
+	if err := VerifyChecksum(data, c); err != nil {
+		t.Errorf("matching content: %v", err)
+	}
+	if err := VerifyChecksum(data[:4], c); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("truncated content: expected ErrChecksumMismatch, got %v", err)
+	}
+
+	if _, ok, err := ParseChecksum(""); err != nil || ok {
+		t.Errorf("no header: got %v, %v", ok, err)
+	}
+	for _, header := range []string{
+		"crc32:deadbeef",
+		"sha256:xyz",
+		"deadbeef",
+		"sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:",
+	} {
+		if _, _, err := ParseChecksum(header); err == nil {
+			t.Errorf("%q: expected error", header)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package fsops
+
+// DiskSpace describes the free space on a filesystem, as available to
+// unprivileged users. TotalInodes is zero on filesystems without a fixed
+// inode table, which never run out of them.
+type DiskSpace struct {
+	FreeBytes   uint64
+	TotalBytes  uint64
+	FreeInodes  uint64
+	TotalInodes uint64
+}
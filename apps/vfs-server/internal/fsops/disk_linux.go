@@ -0,0 +1,21 @@
+package fsops
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// StatDisk reports the free space on the filesystem containing path.
+func StatDisk(path string) (DiskSpace, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return DiskSpace{}, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return DiskSpace{
+		FreeBytes:   st.Bavail * uint64(st.Bsize),
+		TotalBytes:  st.Blocks * uint64(st.Bsize),
+		FreeInodes:  st.Ffree,
+		TotalInodes: st.Files,
+	}, nil
+}
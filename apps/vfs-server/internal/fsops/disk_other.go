@@ -0,0 +1,14 @@
+//go:build !linux
+
+package fsops
+
+import (
+	"errors"
+	"os"
+)
+
+// StatDisk reports the free space on the filesystem containing path. It is
+// only implemented on Linux.
+func StatDisk(path string) (DiskSpace, error) {
+	return DiskSpace{}, &os.PathError{Op: "statfs", Path: path, Err: errors.ErrUnsupported}
+}
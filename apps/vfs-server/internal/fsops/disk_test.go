@@ -0,0 +1,30 @@
+package fsops
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestStatDisk(t *testing.T) {
+	space, err := StatDisk(t.TempDir())
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, errors.ErrUnsupported) {
+			t.Fatalf("expected ErrUnsupported, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if space.TotalBytes == 0 || space.FreeBytes > space.TotalBytes {
+		t.Fatalf("unexpected space %+v", space)
+	}
+	if space.FreeInodes > space.TotalInodes {
+		t.Fatalf("unexpected inodes %+v", space)
+	}
+
+	if _, err := StatDisk(t.TempDir() + "/missing"); err == nil {
+		t.Fatal("expected an error for a missing path")
+	}
+}
@@ -0,0 +1,61 @@
+package fsops
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"syscall"
+)
+
+// ErrWorkspaceRoot is returned for operations that would rename or replace
+// the workspace root itself.
+var ErrWorkspaceRoot = errors.New("operation not allowed on the workspace root")
+
+// APIError is the status, code and message a failed workspace operation is
+// reported to clients with. Messages are fixed per code so that host paths
+// and OS details never reach the response.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// errnoErrors maps the OS errors clients can cause or act on to stable codes.
+var errnoErrors = []struct {
+	errno syscall.Errno
+	APIError
+}{
+	{syscall.ENOENT, APIError{http.StatusNotFound, "NOT_FOUND", "file or directory not found"}},
+	{syscall.EEXIST, APIError{http.StatusConflict, "ALREADY_EXISTS", "file or directory already exists"}},
+	{syscall.ENOTDIR, APIError{http.StatusConflict, "NOT_DIRECTORY", "path or one of its parents is not a directory"}},
+	{syscall.EISDIR, APIError{http.StatusConflict, "IS_DIRECTORY", "path is a directory"}},
+	{syscall.ENOTEMPTY, APIError{http.StatusConflict, "NOT_EMPTY", "directory is not empty"}},
+	{syscall.EACCES, APIError{http.StatusForbidden, "PERMISSION_DENIED", "permission denied"}},
+	{syscall.EPERM, APIError{http.StatusForbidden, "PERMISSION_DENIED", "operation not permitted"}},
+	{syscall.ENOSPC, APIError{http.StatusInsufficientStorage, "NO_SPACE", "no space left on the workspace volume"}},
+	{syscall.EDQUOT, APIError{http.StatusInsufficientStorage, "NO_SPACE", "disk quota exceeded on the workspace volume"}},
+	{syscall.EROFS, APIError{http.StatusServiceUnavailable, "READ_ONLY", "workspace volume is read-only"}},
+	{syscall.ENAMETOOLONG, APIError{http.StatusBadRequest, "NAME_TOO_LONG", "file name too long"}},
+}
+
+// MapError classifies err from a workspace operation. It returns false for
+// errors with no client-facing meaning, which callers report as internal.
+func MapError(err error) (APIError, bool) {
+	switch {
+	case errors.Is(err, ErrSymlink):
+		return APIError{http.StatusForbidden, "PATH_TRAVERSAL", ErrSymlink.Error()}, true
+	case errors.Is(err, ErrEscapes):
+		return APIError{http.StatusForbidden, "PATH_TRAVERSAL", ErrEscapes.Error()}, true
+	case errors.Is(err, ErrWorkspaceRoot):
+		return APIError{http.StatusBadRequest, "BAD_REQUEST", ErrWorkspaceRoot.Error()}, true
+	case errors.Is(err, fs.ErrNotExist):
+		// Also matches ENOENT, but covers errors that only implement Is.
+		return errnoErrors[0].APIError, true
+	}
+	for _, e := range errnoErrors {
+		if errors.Is(err, e.errno) {
+			return e.APIError, true
+		}
+	}
+	return APIError{}, false
+}
@@ -0,0 +1,67 @@
+package fsops
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{&os.PathError{Op: "open", Path: "/srv/ws/a", Err: syscall.ENOENT}, http.StatusNotFound, "NOT_FOUND"},
+		{os.ErrNotExist, http.StatusNotFound, "NOT_FOUND"},
+		{&os.PathError{Op: "mkdir", Path: "/srv/ws/a", Err: syscall.EEXIST}, http.StatusConflict, "ALREADY_EXISTS"},
+		{&os.PathError{Op: "open", Path: "/srv/ws/a/b", Err: syscall.ENOTDIR}, http.StatusConflict, "NOT_DIRECTORY"},
+		{&os.PathError{Op: "open", Path: "/srv/ws/a", Err: syscall.EISDIR}, http.StatusConflict, "IS_DIRECTORY"},
+		{&os.LinkError{Op: "rename", Old: "/srv/ws/a", New: "/srv/ws/b", Err: syscall.ENOTEMPTY}, http.StatusConflict, "NOT_EMPTY"},
+		{&os.PathError{Op: "open", Path: "/srv/ws/a", Err: syscall.EACCES}, http.StatusForbidden, "PERMISSION_DENIED"},
+		{fmt.Errorf("write: %w", syscall.ENOSPC), http.StatusInsufficientStorage, "NO_SPACE"},
+		{&os.PathError{Op: "open", Path: "/srv/ws/a", Err: syscall.EROFS}, http.StatusServiceUnavailable, "READ_ONLY"},
+		{&os.PathError{Op: "open", Path: "/srv/ws/a", Err: syscall.ENAMETOOLONG}, http.StatusBadRequest, "NAME_TOO_LONG"},
+		{ErrSymlink, http.StatusForbidden, "PATH_TRAVERSAL"},
+		{ErrEscapes, http.StatusForbidden, "PATH_TRAVERSAL"},
+		{errRootItself("rename", "."), http.StatusBadRequest, "BAD_REQUEST"},
+	}
+	for _, tt := range tests {
+		got, ok := MapError(tt.err)
+		if !ok || got.Status != tt.status || got.Code != tt.code {
+			t.Errorf("%v: got %+v (ok=%v), want %d %s", tt.err, got, ok, tt.status, tt.code)
+		}
+	}
+
+	if _, ok := MapError(errors.New("disk controller on fire")); ok {
+		t.Error("expected unknown errors to be left unmapped")
+	}
+}
+
+func TestMapErrorFromRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	root, err := OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	_, err = root.Stat(filepath.Join(dir, "file.txt", "below"))
+	if got, _ := MapError(err); got.Code != "NOT_DIRECTORY" {
+		t.Errorf("stat below a file: got %q from %v", got.Code, err)
+	}
+	err = root.Symlink("dir", filepath.Join(dir, "file.txt"))
+	if got, _ := MapError(err); got.Code != "ALREADY_EXISTS" {
+		t.Errorf("symlink over a file: got %q from %v", got.Code, err)
+	}
+}
@@ -0,0 +1,647 @@
+package fsops
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ArchiveTar is an uncompressed tar, which extraction accepts besides
+// ArchiveZip and ArchiveTarGz.
+const ArchiveTar = "tar"
+
+var (
+	// ErrUnsafeEntry is returned for archive entries that would land outside
+	// the target directory or link out of the workspace.
+	ErrUnsafeEntry = errors.New("unsafe archive entry")
+	// ErrArchiveLimit is returned for archives beyond the ExtractLimits.
+	ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+	// ErrInvalidArchive is returned for corrupt or unrecognised archives.
+	ErrInvalidArchive = errors.New("invalid archive")
+)
+
+// ExtractLimits bound what an extraction may produce. Zero disables a limit.
+type ExtractLimits struct {
+	MaxEntries int
+	// MaxBytes caps the total uncompressed size of the files.
+	MaxBytes int64
+	// MaxRatio caps the uncompressed size over the archive size. Archives
+	// expanding to less than ratioFloor are exempt, since small text
+	// archives compress far better than anything worth guarding against.
+	MaxRatio float64
+}
+
+const ratioFloor = 1 << 20
+
+// ExtractStats counts what an extraction wrote.
+type ExtractStats struct {
+	Entries  int
+	Files    int
+	Dirs     int
+	Symlinks int
+	// Skipped counts entries of other types, such as devices and fifos.
+	Skipped int
+	Bytes   int64
+}
+
+// EntryError reports an archive entry that cannot be extracted.
+type EntryError struct {
+	Name   string
+	Reason string
+	Err    error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("entry %q: %s", e.Name, e.Reason)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// DetectArchiveFormat recognises zip, gzip (taken to be tar.gz) and tar by
+// their signatures, returning "" for anything else.
+func DetectArchiveFormat(ra io.ReaderAt) string {
+	head := make([]byte, 262)
+	n, _ := ra.ReadAt(head, 0)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveZip
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return ArchiveTarGz
+	case len(head) == 262 && string(head[257:262]) == "ustar":
+		return ArchiveTar
+	}
+	return ""
+}
+
+// Extraction is a validated plan to unpack an archive into a directory.
+type Extraction struct {
+	root      *Root
+	dir       string
+	dirRel    string
+	ra        io.ReaderAt
+	size      int64
+	format    string
+	limits    ExtractLimits
+	noReplace bool
+
+	// NewFiles and NetBytes are the storage the extraction will add: the
+	// files and links it creates, and the bytes it writes less those of the
+	// files it replaces.
+	NewFiles int64
+	NetBytes int64
+	// WrittenFiles and WrittenBytes are the same for what Run actually did,
+	// which falls short of the plan when it fails part way.
+	WrittenFiles int64
+	WrittenBytes int64
+}
+
+// PlanExtract reads through the archive of size bytes at ra, in format,
+// checking that every entry can be extracted into dir before anything is
+// written. Entries must stay beneath dir, symlinks inside the workspace and
+// hard links on files earlier in the archive; nothing may pass through a
+// symlink, whether the archive creates it or it is already in dir. With noReplace, existing files make
+// the plan fail with an EEXIST error.
+func PlanExtract(r *Root, dir string, ra io.ReaderAt, size int64, format string, limits ExtractLimits, noReplace bool) (*Extraction, error) {
+	dirRel, err := r.rel("extract", dir)
+	if err != nil {
+		return nil, err
+	}
+	x := &Extraction{
+		root:      r,
+		dir:       dir,
+		dirRel:    dirRel,
+		ra:        ra,
+		size:      size,
+		format:    format,
+		limits:    limits,
+		noReplace: noReplace,
+	}
+	switch info, err := r.Stat(dir); {
+	case err == nil && !info.IsDir():
+		return nil, &os.PathError{Op: "extract", Path: dir, Err: syscall.ENOTDIR}
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	v := x.newValidator()
+	dirs := make(map[string]bool)
+	planned := make(map[string]int64)
+	err = x.walk(func(e *archiveEntry) error {
+		name, err := v.check(e)
+		if err != nil || name == "" {
+			return err
+		}
+		parent := path.Dir(name)
+		if e.kind == entryDir {
+			parent = name
+		}
+		if err := x.planDirs(e.name, parent, dirs); err != nil {
+			return err
+		}
+		if e.kind == entryDir {
+			return nil
+		}
+		return x.planReplace(filepath.Join(dir, filepath.FromSlash(name)), e, planned)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxRatio > 0 && v.bytes > ratioFloor && float64(v.bytes) > limits.MaxRatio*float64(size) {
+		return nil, fmt.Errorf("%w: expands more than %gx", ErrArchiveLimit, limits.MaxRatio)
+	}
+	return x, nil
+}
+
+// planDirs checks the directories along rel, a slash-separated path below
+// the target directory, that already exist there. A symlink among them is
+// refused up front: resolution would refuse it too, but only once the
+// entries before it had been written. checked remembers directories already
+// seen across entries.
+func (x *Extraction) planDirs(entry, rel string, checked map[string]bool) error {
+	var cur string
+	for _, part := range strings.Split(rel, "/") {
+		if part == "." {
+			return nil
+		}
+		cur = path.Join(cur, part)
+		if checked[cur] {
+			continue
+		}
+		target := filepath.Join(x.dir, filepath.FromSlash(cur))
+		info, err := x.root.Lstat(target)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// Nothing below a missing directory exists yet either.
+			return nil
+		case err != nil:
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			return &EntryError{Name: entry, Reason: "path runs through a symlink in the target directory", Err: ErrUnsafeEntry}
+		case !info.IsDir():
+			return &os.PathError{Op: "extract", Path: target, Err: syscall.ENOTDIR}
+		}
+		checked[cur] = true
+	}
+	return nil
+}
+
+// planReplace accounts for the entry e landing on target. planned holds the
+// size of each target earlier entries land on, so a name the archive
+// repeats is counted once, at the size of its last entry.
+func (x *Extraction) planReplace(target string, e *archiveEntry, planned map[string]int64) error {
+	var size int64
+	if e.kind == entryFile {
+		size = e.size
+	}
+	if prev, ok := planned[target]; ok {
+		if x.noReplace {
+			return &os.PathError{Op: "extract", Path: target, Err: syscall.EEXIST}
+		}
+		x.NetBytes += size - prev
+		planned[target] = size
+		return nil
+	}
+	info, err := x.root.Lstat(target)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		x.NewFiles++
+		x.NetBytes += size
+		planned[target] = size
+		return nil
+	case err != nil:
+		return err
+	case info.IsDir():
+		return &os.PathError{Op: "extract", Path: target, Err: syscall.EISDIR}
+	case x.noReplace:
+		return &os.PathError{Op: "extract", Path: target, Err: syscall.EEXIST}
+	}
+	x.NetBytes += size
+	if info.Mode().IsRegular() {
+		x.NetBytes -= info.Size()
+	}
+	planned[target] = size
+	return nil
+}
+
+// Run extracts the archive, checking each entry again as it goes since the
+// archive may have changed since it was planned. An error leaves the
+// entries before it in place and removes what it had written of the one it
+// failed on.
+func (x *Extraction) Run() (ExtractStats, error) {
+	var stats ExtractStats
+	if err := x.root.MkdirAll(x.dir, 0o755); err != nil {
+		return stats, err
+	}
+
+	v := x.newValidator()
+	err := x.walk(func(e *archiveEntry) error {
+		stats.Entries++
+		name, err := v.check(e)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			if e.kind == entryOther {
+				stats.Skipped++
+			}
+			return nil
+		}
+		target := filepath.Join(x.dir, filepath.FromSlash(name))
+
+		if e.kind == entryDir {
+			if err := x.root.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			stats.Dirs++
+			return nil
+		}
+		replaced, err := x.clearTarget(target)
+		if err != nil {
+			return err
+		}
+		if replaced != nil {
+			x.WrittenFiles--
+			if replaced.Mode().IsRegular() {
+				x.WrittenBytes -= replaced.Size()
+			}
+		}
+		switch e.kind {
+		case entryFile:
+			n, err := x.writeFile(target, e)
+			if err != nil {
+				return err
+			}
+			stats.Bytes += n
+			stats.Files++
+			x.WrittenBytes += n
+		case entrySymlink:
+			if err := x.root.Symlink(e.link, target); err != nil {
+				return err
+			}
+			stats.Symlinks++
+		case entryLink:
+			old := filepath.Join(x.dir, filepath.FromSlash(e.link))
+			if err := x.root.Link(old, target); err != nil {
+				return err
+			}
+			stats.Files++
+		}
+		x.WrittenFiles++
+		return nil
+	})
+	return stats, err
+}
+
+// clearTarget creates the parents of target and removes what is at target,
+// so that writing a file replaces a symlink rather than following it. It
+// returns what it removed, if anything.
+func (x *Extraction) clearTarget(target string) (os.FileInfo, error) {
+	if err := x.root.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return nil, err
+	}
+	info, err := x.root.Lstat(target)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case info.IsDir():
+		return nil, &os.PathError{Op: "extract", Path: target, Err: syscall.EISDIR}
+	case x.noReplace:
+		return nil, &os.PathError{Op: "extract", Path: target, Err: syscall.EEXIST}
+	}
+	return info, x.root.RemoveAll(target)
+}
+
+// writeFile copies the content of e to target, failing if the content runs
+// past the size in the entry's header, which the limits were checked
+// against. A file that fails part way is removed again.
+func (x *Extraction) writeFile(target string, e *archiveEntry) (int64, error) {
+	perm := os.FileMode(0o644)
+	if e.mode&0o111 != 0 {
+		perm = 0o755
+	}
+	f, err := x.root.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return 0, err
+	}
+	content, err := e.open()
+	if err != nil {
+		f.Close()
+		x.root.RemoveAll(target)
+		return 0, err
+	}
+	defer content.Close()
+	n, err := io.Copy(f, io.LimitReader(content, e.size+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > e.size {
+		err = &EntryError{Name: e.name, Reason: "content is larger than its header says", Err: ErrArchiveLimit}
+	}
+	if err != nil {
+		x.root.RemoveAll(target)
+		return 0, err
+	}
+	return n, nil
+}
+
+// validator checks entries against the limits and the safety rules, keeping
+// the state the rules need across one pass over the archive.
+type validator struct {
+	x       *Extraction
+	entries int
+	bytes   int64
+	files   map[string]bool
+	links   map[string]bool
+}
+
+func (x *Extraction) newValidator() *validator {
+	return &validator{x: x, files: make(map[string]bool), links: make(map[string]bool)}
+}
+
+// check returns the cleaned name e extracts to, or "" for entries that are
+// skipped: the target directory itself and entries of other types.
+func (v *validator) check(e *archiveEntry) (string, error) {
+	limits := v.x.limits
+	v.entries++
+	if limits.MaxEntries > 0 && v.entries > limits.MaxEntries {
+		return "", fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, limits.MaxEntries)
+	}
+	if e.kind == entryOther {
+		return "", nil
+	}
+
+	name, ok := cleanEntryName(e.name)
+	if !ok {
+		return "", &EntryError{Name: e.name, Reason: "path is absolute or leaves the target directory", Err: ErrUnsafeEntry}
+	}
+	if name == "." {
+		return "", nil
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if v.links[dir] {
+			return "", &EntryError{Name: e.name, Reason: "path runs through a symlink in the archive", Err: ErrUnsafeEntry}
+		}
+	}
+
+	switch e.kind {
+	case entryFile:
+		v.bytes += e.size
+		if limits.MaxBytes > 0 && v.bytes > limits.MaxBytes {
+			return "", fmt.Errorf("%w: more than %d bytes uncompressed", ErrArchiveLimit, limits.MaxBytes)
+		}
+		v.files[name] = true
+	case entrySymlink:
+		rel := filepath.Join(v.x.dirRel, filepath.FromSlash(name))
+		if e.link == "" || path.IsAbs(e.link) || filepath.IsAbs(e.link) || !linkStaysBeneath(rel, e.link) {
+			return "", &EntryError{Name: e.name, Reason: "symlink points outside the workspace", Err: ErrUnsafeEntry}
+		}
+		v.links[name] = true
+	case entryLink:
+		old, ok := cleanEntryName(e.link)
+		if !ok || !v.files[old] {
+			return "", &EntryError{Name: e.name, Reason: "hard link target is not an earlier file in the archive", Err: ErrUnsafeEntry}
+		}
+		e.link = old
+	}
+	return name, nil
+}
+
+// cleanEntryName converts an entry name to a clean slash-separated path
+// relative to the target directory. Names that are absolute, carry a drive
+// letter or contain ".." are refused outright, even where ".." would stay
+// inside: no archive a user meant to upload needs one.
+func cleanEntryName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) {
+		return "", false
+	}
+	if len(name) >= 2 && name[1] == ':' && ('a' <= name[0]|0x20 && name[0]|0x20 <= 'z') {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	return path.Clean(name), true
+}
+
+// Entry kinds extraction distinguishes.
+const (
+	entryFile = iota
+	entryDir
+	entrySymlink
+	entryLink
+	entryOther
+)
+
+// archiveEntry is one entry of a zip or tar, read through walk.
+type archiveEntry struct {
+	name string
+	kind int
+	size int64
+	mode os.FileMode
+	// link is a symlink's target or a hard link's original.
+	link string
+	open func() (io.ReadCloser, error)
+}
+
+// maxLinkTarget bounds the zip entries read as symlink targets.
+const maxLinkTarget = 4096
+
+// walk calls fn for every entry of the archive. Errors reading the archive
+// are wrapped in ErrInvalidArchive; errors from fn are returned as they are.
+func (x *Extraction) walk(fn func(e *archiveEntry) error) error {
+	switch x.format {
+	case ArchiveZip:
+		return x.walkZip(fn)
+	case ArchiveTar, ArchiveTarGz:
+		return x.walkTar(fn)
+	}
+	return fmt.Errorf("%w: unsupported format %q", ErrInvalidArchive, x.format)
+}
+
+func (x *Extraction) walkZip(fn func(e *archiveEntry) error) error {
+	// zip.NewReader loads the whole central directory, so an archive of
+	// millions of tiny entries is turned away before it is read.
+	if max := x.limits.MaxEntries; max > 0 {
+		if n, ok := zipEntryCount(x.ra, x.size); ok && n > uint64(max) {
+			return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, max)
+		}
+	}
+	zr, err := zip.NewReader(x.ra, x.size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		e := &archiveEntry{
+			name: f.Name,
+			size: int64(f.UncompressedSize64),
+			mode: mode,
+			open: func() (io.ReadCloser, error) {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+				}
+				return archiveReadCloser{rc}, nil
+			},
+		}
+		switch {
+		case mode.IsDir() || strings.HasSuffix(f.Name, "/"):
+			e.kind = entryDir
+		case mode&os.ModeSymlink != 0:
+			e.kind = entrySymlink
+			if f.UncompressedSize64 > maxLinkTarget {
+				return &EntryError{Name: f.Name, Reason: "symlink target too long", Err: ErrUnsafeEntry}
+			}
+			rc, err := e.open()
+			if err != nil {
+				return err
+			}
+			target, err := io.ReadAll(io.LimitReader(rc, maxLinkTarget))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			e.link = string(target)
+		case mode.IsRegular():
+			e.kind = entryFile
+		default:
+			e.kind = entryOther
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipEntryCount reads the entry count from the end of central directory
+// record. A zip64 archive records 0xffff there, which is taken at face value
+// as a lower bound.
+func zipEntryCount(ra io.ReaderAt, size int64) (uint64, bool) {
+	const eocdLen = 22
+	tail := min(size, eocdLen+0xffff)
+	buf := make([]byte, tail)
+	if _, err := ra.ReadAt(buf, size-tail); err != nil && err != io.EOF {
+		return 0, false
+	}
+	i := bytes.LastIndex(buf, []byte("PK\x05\x06"))
+	if i < 0 || len(buf)-i < eocdLen {
+		return 0, false
+	}
+	return uint64(binary.LittleEndian.Uint16(buf[i+10:])), true
+}
+
+func (x *Extraction) walkTar(fn func(e *archiveEntry) error) error {
+	// The decompressed stream is bounded too: tar skips file content by
+	// reading through it, which for a gzip bomb would mean inflating all of
+	// it just to find the next header.
+	var rd io.Reader = io.NewSectionReader(x.ra, 0, x.size)
+	if x.format == ArchiveTarGz {
+		gz, err := gzip.NewReader(rd)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		defer gz.Close()
+		rd = &boundedReader{r: gz, limits: x.limits, size: x.size}
+	}
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, ErrArchiveLimit) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		e := &archiveEntry{
+			name: hdr.Name,
+			size: hdr.Size,
+			mode: hdr.FileInfo().Mode(),
+			link: hdr.Linkname,
+			open: func() (io.ReadCloser, error) {
+				return archiveReadCloser{io.NopCloser(tr)}, nil
+			},
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			e.kind = entryFile
+		case tar.TypeDir:
+			e.kind = entryDir
+		case tar.TypeSymlink:
+			e.kind = entrySymlink
+		case tar.TypeLink:
+			e.kind = entryLink
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			e.kind = entryOther
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveReadCloser marks errors reading entry content as ErrInvalidArchive,
+// so that a corrupt entry is not reported as a workspace failure.
+type archiveReadCloser struct {
+	io.ReadCloser
+}
+
+func (a archiveReadCloser) Read(p []byte) (int, error) {
+	n, err := a.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && !errors.Is(err, ErrArchiveLimit) {
+		err = fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	return n, err
+}
+
+// boundedReader fails with ErrArchiveLimit once a decompressed stream grows
+// past what the limits allow: MaxBytes of content plus room for headers,
+// and MaxRatio times the compressed size.
+type boundedReader struct {
+	r      io.Reader
+	limits ExtractLimits
+	size   int64
+	read   int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+	if b.limits.MaxBytes > 0 {
+		// Tar headers and padding take at most a few kilobytes an entry.
+		overhead := int64(1 << 20)
+		if b.limits.MaxEntries > 0 {
+			overhead += int64(b.limits.MaxEntries) * 4096
+		}
+		if b.read > b.limits.MaxBytes+overhead {
+			return n, fmt.Errorf("%w: more than %d bytes uncompressed", ErrArchiveLimit, b.limits.MaxBytes)
+		}
+	}
+	if b.limits.MaxRatio > 0 && b.read > ratioFloor && float64(b.read) > b.limits.MaxRatio*float64(b.size) {
+		return n, fmt.Errorf("%w: expands more than %gx", ErrArchiveLimit, b.limits.MaxRatio)
+	}
+	return n, err
+}
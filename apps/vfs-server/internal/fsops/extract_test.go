@@ -0,0 +1,274 @@
+package fsops
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testEntry struct {
+	name    string
+	content string
+	// typeflag is a tar type; zip entries are files, directories when the
+	// name ends in a slash, or symlinks for tar.TypeSymlink.
+	typeflag byte
+	link     string
+}
+
+func tarGzBytes(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.link, Mode: 0o644, Size: int64(len(e.content))}
+		if e.typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipEntries(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		content := e.content
+		if e.typeflag == tar.TypeSymlink {
+			hdr.SetMode(os.ModeSymlink | 0o777)
+			content = e.link
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func extract(t *testing.T, root *Root, data []byte, limits ExtractLimits, noReplace bool) (ExtractStats, error) {
+	t.Helper()
+	ra := bytes.NewReader(data)
+	format := DetectArchiveFormat(ra)
+	x, err := PlanExtract(root, filepath.Join(root.Path(), "out"), ra, int64(len(data)), format, limits, noReplace)
+	if err != nil {
+		return ExtractStats{}, err
+	}
+	return x.Run()
+}
+
+func TestExtract(t *testing.T) {
+	root, _ := newTestRoot(t)
+	data := tarGzBytes(t,
+		testEntry{name: "./", typeflag: tar.TypeDir},
+		testEntry{name: "data/", typeflag: tar.TypeDir},
+		testEntry{name: "data/a.csv", content: "x,y\n1,2\n"},
+		testEntry{name: "data/latest", typeflag: tar.TypeSymlink, link: "a.csv"},
+		testEntry{name: "data/copy.csv", typeflag: tar.TypeLink, link: "data/a.csv"},
+		testEntry{name: "pipe", typeflag: tar.TypeFifo},
+	)
+
+	stats, err := extract(t, root, data, ExtractLimits{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ExtractStats{Entries: 6, Files: 2, Dirs: 1, Symlinks: 1, Skipped: 1, Bytes: 8}
+	if stats != want {
+		t.Errorf("stats: got %+v, want %+v", stats, want)
+	}
+	got, err := os.ReadFile(filepath.Join(root.Path(), "out", "data", "latest"))
+	if err != nil || string(got) != "x,y\n1,2\n" {
+		t.Errorf("symlinked content: got %q, %v", got, err)
+	}
+
+	if _, err := extract(t, root, data, ExtractLimits{}, true); !errors.Is(err, os.ErrExist) {
+		t.Errorf("noReplace over existing files: expected ErrExist, got %v", err)
+	}
+	if _, err := extract(t, root, data, ExtractLimits{}, false); err != nil {
+		t.Errorf("replacing existing files: %v", err)
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	root, _ := newTestRoot(t)
+	data := zipEntries(t,
+		testEntry{name: `docs\readme.md`, content: "# hi"},
+		testEntry{name: "docs/link", typeflag: tar.TypeSymlink, link: "readme.md"},
+	)
+	stats, err := extract(t, root, data, ExtractLimits{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 1 || stats.Symlinks != 1 {
+		t.Errorf("stats: got %+v", stats)
+	}
+	if got, err := os.ReadFile(filepath.Join(root.Path(), "out", "docs", "readme.md")); err != nil || string(got) != "# hi" {
+		t.Errorf("content: got %q, %v", got, err)
+	}
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+	}{
+		{"zip slip", []testEntry{{name: "../evil.txt", content: "x"}}},
+		{"nested zip slip", []testEntry{{name: "a/../../evil.txt", content: "x"}}},
+		{"absolute", []testEntry{{name: "/etc/passwd", content: "x"}}},
+		{"drive letter", []testEntry{{name: `C:\evil.txt`, content: "x"}}},
+		{"escaping symlink", []testEntry{{name: "link", typeflag: tar.TypeSymlink, link: "../../../etc"}}},
+		{"absolute symlink", []testEntry{{name: "link", typeflag: tar.TypeSymlink, link: "/etc"}}},
+		{"write through symlink", []testEntry{
+			{name: "link", typeflag: tar.TypeSymlink, link: "."},
+			{name: "link/x.txt", content: "x"},
+		}},
+		{"hard link outside", []testEntry{{name: "link", typeflag: tar.TypeLink, link: "../../secret.txt"}}},
+	}
+	for _, tt := range tests {
+		for format, data := range map[string][]byte{
+			"tar.gz": tarGzBytes(t, tt.entries...),
+			"zip":    zipEntries(t, tt.entries...),
+		} {
+			if format == "zip" && tt.entries[0].typeflag == tar.TypeLink {
+				continue
+			}
+			root, _ := newTestRoot(t)
+			_, err := extract(t, root, data, ExtractLimits{}, false)
+			if !errors.Is(err, ErrUnsafeEntry) {
+				t.Errorf("%s (%s): expected ErrUnsafeEntry, got %v", tt.name, format, err)
+			}
+			if _, err := os.Lstat(filepath.Join(root.Path(), "out")); !os.IsNotExist(err) {
+				t.Errorf("%s (%s): target written before the archive was rejected", tt.name, format)
+			}
+		}
+	}
+}
+
+func TestExtractRefusesSymlinksInTarget(t *testing.T) {
+	for name, entries := range map[string][]testEntry{
+		"file":      {{name: "ok.txt", content: "x"}, {name: "l/x.txt", content: "x"}},
+		"directory": {{name: "ok.txt", content: "x"}, {name: "l/sub/", typeflag: tar.TypeDir}},
+	} {
+		root, _ := newTestRoot(t)
+		if err := root.MkdirAll(filepath.Join(root.Path(), "out"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.Symlink("../docs", filepath.Join(root.Path(), "out", "l")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := extract(t, root, tarGzBytes(t, entries...), ExtractLimits{}, false); !errors.Is(err, ErrUnsafeEntry) {
+			t.Errorf("%s: expected ErrUnsafeEntry, got %v", name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(root.Path(), "out", "ok.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: entries written before the link was found", name)
+		}
+		for _, p := range []string{"x.txt", "sub"} {
+			if _, err := os.Lstat(filepath.Join(root.Path(), "docs", p)); !os.IsNotExist(err) {
+				t.Errorf("%s: wrote %s through the link", name, p)
+			}
+		}
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	zeros := string(make([]byte, 4<<20))
+	tests := []struct {
+		name   string
+		data   func(t *testing.T) []byte
+		limits ExtractLimits
+	}{
+		{"entries", func(t *testing.T) []byte {
+			return zipEntries(t, testEntry{name: "a"}, testEntry{name: "b"}, testEntry{name: "c"})
+		}, ExtractLimits{MaxEntries: 2}},
+		{"bytes", func(t *testing.T) []byte {
+			return tarGzBytes(t, testEntry{name: "a", content: "12345"}, testEntry{name: "b", content: "12345"})
+		}, ExtractLimits{MaxBytes: 8}},
+		{"zip ratio", func(t *testing.T) []byte {
+			return zipEntries(t, testEntry{name: "bomb", content: zeros})
+		}, ExtractLimits{MaxRatio: 100}},
+		{"tar.gz ratio", func(t *testing.T) []byte {
+			return tarGzBytes(t, testEntry{name: "bomb", content: zeros})
+		}, ExtractLimits{MaxRatio: 100}},
+	}
+	for _, tt := range tests {
+		root, _ := newTestRoot(t)
+		if _, err := extract(t, root, tt.data(t), tt.limits, false); !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("%s: expected ErrArchiveLimit, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestPlanExtractCountsDuplicateEntriesOnce(t *testing.T) {
+	entries := []testEntry{
+		{name: "a.txt", content: "first version"},
+		{name: "./a.txt", content: "second"},
+		{name: "b.txt", content: "b"},
+	}
+	for format, data := range map[string][]byte{
+		"zip":    zipEntries(t, entries...),
+		"tar.gz": tarGzBytes(t, entries...),
+	} {
+		root, _ := newTestRoot(t)
+		ra := bytes.NewReader(data)
+		x, err := PlanExtract(root, filepath.Join(root.Path(), "out"), ra, int64(len(data)), DetectArchiveFormat(ra), ExtractLimits{}, false)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if x.NewFiles != 2 || x.NetBytes != 7 {
+			t.Errorf("%s: planned %d files, %d bytes; want 2 files, 7 bytes", format, x.NewFiles, x.NetBytes)
+		}
+		stats, err := x.Run()
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if x.WrittenFiles != x.NewFiles {
+			t.Errorf("%s: wrote %d new files, planned %d (stats %+v)", format, x.WrittenFiles, x.NewFiles, stats)
+		}
+		if got, _ := os.ReadFile(filepath.Join(root.Path(), "out", "a.txt")); string(got) != "second" {
+			t.Errorf("%s: a.txt = %q, want the last entry", format, got)
+		}
+
+		ra = bytes.NewReader(data)
+		if _, err := PlanExtract(root, filepath.Join(root.Path(), "fresh"), ra, int64(len(data)), DetectArchiveFormat(ra), ExtractLimits{}, true); !errors.Is(err, os.ErrExist) {
+			t.Errorf("%s: noReplace with a repeated entry: expected ErrExist, got %v", format, err)
+		}
+	}
+}
+
+func TestExtractInvalidArchive(t *testing.T) {
+	root, _ := newTestRoot(t)
+	data := tarGzBytes(t, testEntry{name: "a.txt", content: "hello"})
+	data = data[:len(data)/2]
+	ra := bytes.NewReader(data)
+	_, err := PlanExtract(root, filepath.Join(root.Path(), "out"), ra, int64(len(data)), ArchiveTarGz, ExtractLimits{}, false)
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("truncated archive: expected ErrInvalidArchive, got %v", err)
+	}
+	if got := DetectArchiveFormat(bytes.NewReader([]byte("plain text"))); got != "" {
+		t.Errorf("DetectArchiveFormat: got %q for text", got)
+	}
+}
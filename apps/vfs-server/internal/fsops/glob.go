@@ -0,0 +1,90 @@
+package fsops
+
+import (
+	"path"
+	"strings"
+)
+
+// GlobFilter selects workspace-relative, slash-separated paths by glob.
+// Patterns use path.Match syntax per segment, plus "**" for any number of
+// segments. A pattern without a slash matches the last segment at any depth,
+// so "*.log" or "node_modules" work the way they do in .gitignore.
+type GlobFilter struct {
+	// Include, when not empty, limits files to those matching one of its
+	// patterns. Directories are still descended into.
+	Include []string
+	// Exclude drops matching files, and matching directories with
+	// everything beneath them.
+	Exclude []string
+}
+
+// Validate reports the first malformed pattern.
+func (f *GlobFilter) Validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			for _, seg := range strings.Split(pattern, "/") {
+				if _, err := path.Match(seg, ""); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Excluded reports whether rel, or the subtree at rel, is left out.
+func (f *GlobFilter) Excluded(rel string) bool {
+	return matchAny(f.Exclude, rel)
+}
+
+// Included reports whether the file at rel passes the filter.
+func (f *GlobFilter) Included(rel string) bool {
+	if f.Excluded(rel) {
+		return false
+	}
+	return len(f.Include) == 0 || matchAny(f.Include, rel)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether the slash-separated path rel matches pattern;
+// see GlobFilter for the syntax.
+func MatchGlob(pattern, rel string) bool {
+	pattern = strings.Trim(strings.TrimPrefix(pattern, "./"), "/")
+	if pattern == "" {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
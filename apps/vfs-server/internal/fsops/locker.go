@@ -1,13 +1,16 @@
 package fsops
 
 import (
+	"context"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
-// PathLocker coordinates conflicting exact-path and directory-subtree writes.
+// PathLocker coordinates conflicting exact-path and directory-subtree writes,
+// and readers that need a subtree to hold still.
 type PathLocker struct {
 	mu sync.Mutex
 
@@ -15,40 +18,92 @@ type PathLocker struct {
 
 	exactLocks   map[string]int
 	subtreeLocks map[string]int
+	// readLocks holds shared subtree locks; see RLockSubtree.
+	readLocks map[string]int
+	// waiters counts callers blocked waiting for a lock.
+	waiters int
+	// observeWait, when set, is told how long each acquisition waited.
+	observeWait func(kind string, waited time.Duration)
 }
 
+// Lock kinds reported to wait observers.
+const (
+	LockKindExact       = "exact"
+	LockKindSubtree     = "subtree"
+	LockKindSubtreeRead = "subtree_read"
+)
+
+// LockStats is a snapshot of a PathLocker's state.
+type LockStats struct {
+	// Exact and Subtree count locked paths; a lock taken on several paths
+	// counts once for each.
+	Exact       int
+	Subtree     int
+	SubtreeRead int
+	Waiters     int
+}
+
+// NewPathLocker creates an unlocked PathLocker.
 func NewPathLocker() *PathLocker {
 	pl := &PathLocker{
 		exactLocks:   make(map[string]int),
 		subtreeLocks: make(map[string]int),
+		readLocks:    make(map[string]int),
 	}
 	pl.cond = sync.NewCond(&pl.mu)
 	return pl
 }
 
 func (pl *PathLocker) LockExact(paths ...string) (unlock func()) {
+	return pl.acquire(LockKindExact, paths, pl.exactLocks, pl.canAcquireExact)
+}
+
+func (pl *PathLocker) LockSubtree(paths ...string) (unlock func()) {
+	return pl.acquire(LockKindSubtree, paths, pl.subtreeLocks, pl.canAcquireSubtree)
+}
+
+// RLockSubtree takes shared locks on the subtrees at paths for a reader that
+// needs a consistent view of them, such as an archive download. Readers do
+// not block each other; writes anywhere inside the subtrees wait for them,
+// and they wait for writes already in progress there.
+func (pl *PathLocker) RLockSubtree(paths ...string) (unlock func()) {
+	return pl.acquire(LockKindSubtreeRead, paths, pl.readLocks, pl.canAcquireSubtreeRead)
+}
+
+// acquire waits until canAcquire allows the normalized paths, then counts
+// them in locks until unlock is called.
+func (pl *PathLocker) acquire(kind string, paths []string, locks map[string]int, canAcquire func([]string) bool) (unlock func()) {
 	keys := normalizeLockPaths(paths)
 	if len(keys) == 0 {
 		return func() {}
 	}
 
+	start := time.Now()
 	pl.mu.Lock()
-	for !pl.canAcquireExact(keys) {
-		pl.cond.Wait()
+	if !canAcquire(keys) {
+		pl.waiters++
+		for !canAcquire(keys) {
+			pl.cond.Wait()
+		}
+		pl.waiters--
 	}
 	for _, key := range keys {
-		pl.exactLocks[key]++
+		locks[key]++
 	}
+	observe := pl.observeWait
 	pl.mu.Unlock()
+	if observe != nil {
+		observe(kind, time.Since(start))
+	}
 
 	var once sync.Once
 	return func() {
 		once.Do(func() {
 			pl.mu.Lock()
 			for _, key := range keys {
-				pl.exactLocks[key]--
-				if pl.exactLocks[key] == 0 {
-					delete(pl.exactLocks, key)
+				locks[key]--
+				if locks[key] == 0 {
+					delete(locks, key)
 				}
 			}
 			pl.cond.Broadcast()
@@ -57,35 +112,50 @@ func (pl *PathLocker) LockExact(paths ...string) (unlock func()) {
 	}
 }
 
-func (pl *PathLocker) LockSubtree(paths ...string) (unlock func()) {
-	keys := normalizeLockPaths(paths)
-	if len(keys) == 0 {
-		return func() {}
-	}
+// ObserveWaits registers fn to be called with the time every acquisition
+// spent waiting, including acquisitions that did not have to wait.
+func (pl *PathLocker) ObserveWaits(fn func(kind string, waited time.Duration)) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.observeWait = fn
+}
 
+// Stats returns the number of held locks and blocked callers.
+func (pl *PathLocker) Stats() LockStats {
 	pl.mu.Lock()
-	for !pl.canAcquireSubtree(keys) {
-		pl.cond.Wait()
+	defer pl.mu.Unlock()
+	stats := LockStats{Waiters: pl.waiters}
+	for _, n := range pl.exactLocks {
+		stats.Exact += n
 	}
-	for _, key := range keys {
-		pl.subtreeLocks[key]++
+	for _, n := range pl.subtreeLocks {
+		stats.Subtree += n
 	}
-	pl.mu.Unlock()
+	for _, n := range pl.readLocks {
+		stats.SubtreeRead += n
+	}
+	return stats
+}
 
-	var once sync.Once
-	return func() {
-		once.Do(func() {
-			pl.mu.Lock()
-			for _, key := range keys {
-				pl.subtreeLocks[key]--
-				if pl.subtreeLocks[key] == 0 {
-					delete(pl.subtreeLocks, key)
-				}
-			}
-			pl.cond.Broadcast()
-			pl.mu.Unlock()
-		})
+// Wait blocks until no locks are held or waited for, or ctx is done. Shutdown
+// uses it to let in-flight writes finish before the process exits.
+func (pl *PathLocker) Wait(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		pl.mu.Lock()
+		pl.cond.Broadcast()
+		pl.mu.Unlock()
+	})
+	defer stop()
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	for len(pl.exactLocks) > 0 || len(pl.subtreeLocks) > 0 || len(pl.readLocks) > 0 || pl.waiters > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pl.cond.Wait()
 	}
+	return nil
 }
 
 func (pl *PathLocker) canAcquireExact(paths []string) bool {
@@ -98,11 +168,39 @@ func (pl *PathLocker) canAcquireExact(paths []string) bool {
 				return false
 			}
 		}
+		for activeRead := range pl.readLocks {
+			if isSameOrDescendant(path, activeRead) {
+				return false
+			}
+		}
 	}
 	return true
 }
 
 func (pl *PathLocker) canAcquireSubtree(paths []string) bool {
+	for _, path := range paths {
+		for activeExact := range pl.exactLocks {
+			if isSameOrDescendant(activeExact, path) {
+				return false
+			}
+		}
+		for activeSubtree := range pl.subtreeLocks {
+			if overlapsSubtree(path, activeSubtree) {
+				return false
+			}
+		}
+		for activeRead := range pl.readLocks {
+			if overlapsSubtree(path, activeRead) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// canAcquireSubtreeRead is canAcquireSubtree without the conflict between
+// readers.
+func (pl *PathLocker) canAcquireSubtreeRead(paths []string) bool {
 	for _, path := range paths {
 		for activeExact := range pl.exactLocks {
 			if isSameOrDescendant(activeExact, path) {
@@ -1,6 +1,8 @@
 package fsops
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -382,6 +384,115 @@ func TestPathLockerRefCountCleanup(t *testing.T) {
 	}
 }
 
+func TestPathLockerWaitDrainsHoldersAndWaiters(t *testing.T) {
+	pl := NewPathLocker()
+
+	firstUnlock := pl.LockExact("/x/a.txt")
+	secondAcquired := make(chan struct{})
+	releaseSecond := make(chan struct{})
+	go func() {
+		unlock := pl.LockExact("/x/a.txt")
+		close(secondAcquired)
+		<-releaseSecond
+		unlock()
+	}()
+	assertBlocked(t, secondAcquired)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pl.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline while locks are held, got %v", err)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		if err := pl.Wait(context.Background()); err != nil {
+			t.Errorf("Wait: %v", err)
+		}
+		close(drained)
+	}()
+
+	// Releasing the first lock hands it to the waiter; Wait must keep
+	// blocking until that one is released too.
+	firstUnlock()
+	assertAcquired(t, secondAcquired)
+	assertBlocked(t, drained)
+	close(releaseSecond)
+	assertAcquired(t, drained)
+}
+
+func TestPathLockerSubtreeReadersShare(t *testing.T) {
+	pl := NewPathLocker()
+
+	unlockRead := pl.RLockSubtree("/x/dir")
+	acquiredReaders := make(chan struct{})
+	go func() {
+		unlockA := pl.RLockSubtree("/x/dir")
+		unlockB := pl.RLockSubtree("/x/dir/sub")
+		unlockA()
+		unlockB()
+		close(acquiredReaders)
+	}()
+
+	assertAcquired(t, acquiredReaders)
+	unlockRead()
+}
+
+func TestPathLockerSubtreeReadBlocksWritesInside(t *testing.T) {
+	pl := NewPathLocker()
+
+	unlockRead := pl.RLockSubtree("/x/dir")
+	if got := pl.Stats().SubtreeRead; got != 1 {
+		t.Fatalf("expected 1 subtree read lock, got %d", got)
+	}
+
+	acquiredExact := make(chan struct{})
+	go func() {
+		unlock := pl.LockExact("/x/dir/a.txt")
+		unlock()
+		close(acquiredExact)
+	}()
+	acquiredAncestor := make(chan struct{})
+	go func() {
+		unlock := pl.LockSubtree("/x")
+		unlock()
+		close(acquiredAncestor)
+	}()
+	acquiredOutside := make(chan struct{})
+	go func() {
+		unlock := pl.LockExact("/x/other.txt")
+		unlock()
+		close(acquiredOutside)
+	}()
+
+	assertAcquired(t, acquiredOutside)
+	assertBlocked(t, acquiredExact)
+	assertBlocked(t, acquiredAncestor)
+	unlockRead()
+	assertAcquired(t, acquiredExact)
+	assertAcquired(t, acquiredAncestor)
+
+	if len(pl.readLocks) != 0 {
+		t.Fatalf("expected read lock entries cleaned up, got %d", len(pl.readLocks))
+	}
+}
+
+func TestPathLockerSubtreeReadWaitsForWritesInside(t *testing.T) {
+	pl := NewPathLocker()
+
+	unlockExact := pl.LockExact("/x/dir/a.txt")
+	acquiredRead := make(chan struct{})
+	go func() {
+		unlock := pl.RLockSubtree("/x/dir")
+		unlock()
+		close(acquiredRead)
+	}()
+
+	assertBlocked(t, acquiredRead)
+	unlockExact()
+	assertAcquired(t, acquiredRead)
+}
+
 func assertBlocked(t *testing.T, acquired <-chan struct{}) {
 	t.Helper()
 
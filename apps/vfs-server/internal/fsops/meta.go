@@ -0,0 +1,65 @@
+package fsops
+
+import (
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileMeta is the metadata the stat endpoint reports, beyond os.FileInfo.
+type FileMeta struct {
+	Size     int64
+	Mode     os.FileMode
+	RawMode  uint32 // st_mode including the file type bits, as Node reports it
+	Inode    uint64
+	Nlink    uint64
+	Modified time.Time
+	Accessed time.Time
+	Changed  time.Time
+	// Born is the creation time, or zero when the filesystem or kernel does
+	// not record it.
+	Born time.Time
+}
+
+// IsDir reports whether m describes a directory.
+func (m *FileMeta) IsDir() bool {
+	return m.Mode.IsDir()
+}
+
+// Extended attributes the server keeps on workspace files. They live in the
+// user namespace, so filesystems without user xattrs simply go without.
+const (
+	xattrPrefix = "user.vfs."
+	// XattrSHA256 caches a file's SHA-256 alongside the modification time
+	// it was computed for; see FormatHashAttr.
+	XattrSHA256 = "sha256"
+	// XattrContentType holds the content type given when the file was
+	// uploaded. It overrides detection until the file is written again.
+	XattrContentType = "content_type"
+)
+
+// FormatHashAttr encodes sum for storage in an xattr. The modification time
+// is stored with it so that a file changed behind the server's back does not
+// report a stale hash.
+func FormatHashAttr(sum []byte, modified time.Time) string {
+	return hex.EncodeToString(sum) + " " + strconv.FormatInt(modified.UnixNano(), 10)
+}
+
+// ParseHashAttr returns the hex digest stored by FormatHashAttr if it was
+// computed for modified.
+func ParseHashAttr(value string, modified time.Time) (string, bool) {
+	digest, stamp, ok := strings.Cut(value, " ")
+	if !ok {
+		return "", false
+	}
+	ns, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil || ns != modified.UnixNano() {
+		return "", false
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", false
+	}
+	return digest, true
+}
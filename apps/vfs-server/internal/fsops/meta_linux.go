@@ -0,0 +1,159 @@
+package fsops
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func (r *Root) statMeta(name string) (*FileMeta, error) {
+	return r.meta("stat", name, unix.O_PATH)
+}
+
+// lstatMeta describes a final link itself; an O_PATH|O_NOFOLLOW descriptor
+// refers to the link rather than refusing it.
+func (r *Root) lstatMeta(name string) (*FileMeta, error) {
+	return r.meta("lstat", name, unix.O_PATH|unix.O_NOFOLLOW)
+}
+
+func (r *Root) meta(op, name string, flags int) (*FileMeta, error) {
+	rel, err := r.rel(op, name)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := openBeneath(r.dirfd(), rel, flags, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	defer unix.Close(fd)
+
+	var stx unix.Statx_t
+	err = unix.Statx(fd, "", unix.AT_EMPTY_PATH|unix.AT_STATX_SYNC_AS_STAT, unix.STATX_BASIC_STATS|unix.STATX_BTIME, &stx)
+	if err == unix.ENOSYS {
+		return fstatMeta(fd, op, name)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+
+	m := &FileMeta{
+		Size:     int64(stx.Size),
+		Mode:     fileMode(uint32(stx.Mode)),
+		RawMode:  uint32(stx.Mode),
+		Inode:    stx.Ino,
+		Nlink:    uint64(stx.Nlink),
+		Modified: statxTime(stx.Mtime),
+		Accessed: statxTime(stx.Atime),
+		Changed:  statxTime(stx.Ctime),
+	}
+	if stx.Mask&unix.STATX_BTIME != 0 {
+		m.Born = statxTime(stx.Btime)
+	}
+	return m, nil
+}
+
+// fstatMeta serves kernels before 4.11, which lack statx and so birth times.
+func fstatMeta(fd int, op, name string) (*FileMeta, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return &FileMeta{
+		Size:     st.Size,
+		Mode:     fileMode(st.Mode),
+		RawMode:  st.Mode,
+		Inode:    st.Ino,
+		Nlink:    uint64(st.Nlink),
+		Modified: time.Unix(st.Mtim.Unix()),
+		Accessed: time.Unix(st.Atim.Unix()),
+		Changed:  time.Unix(st.Ctim.Unix()),
+	}, nil
+}
+
+func statxTime(ts unix.StatxTimestamp) time.Time {
+	return time.Unix(ts.Sec, int64(ts.Nsec))
+}
+
+// fileMode converts st_mode to an os.FileMode the way os.Stat does.
+func fileMode(mode uint32) os.FileMode {
+	m := os.FileMode(mode & 0o777)
+	switch mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		m |= os.ModeDir
+	case unix.S_IFLNK:
+		m |= os.ModeSymlink
+	case unix.S_IFIFO:
+		m |= os.ModeNamedPipe
+	case unix.S_IFSOCK:
+		m |= os.ModeSocket
+	case unix.S_IFBLK:
+		m |= os.ModeDevice
+	case unix.S_IFCHR:
+		m |= os.ModeDevice | os.ModeCharDevice
+	}
+	if mode&unix.S_ISUID != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&unix.S_ISGID != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&unix.S_ISVTX != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// getXattr reads the server attribute key from the regular file name.
+// Filesystems without user xattrs report ENOTSUP, and a missing attribute
+// ENODATA.
+func (r *Root) getXattr(name, key string) (string, error) {
+	f, err := r.openXattrTarget(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 256)
+	for {
+		n, err := unix.Fgetxattr(int(f.Fd()), xattrPrefix+key, buf)
+		if err == unix.ERANGE {
+			buf = make([]byte, len(buf)*4)
+			continue
+		}
+		if err != nil {
+			return "", &os.PathError{Op: "getxattr", Path: name, Err: err}
+		}
+		return string(buf[:n]), nil
+	}
+}
+
+func (r *Root) setXattr(name, key, value string) error {
+	f, err := r.openXattrTarget(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.Fsetxattr(int(f.Fd()), xattrPrefix+key, []byte(value), 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (r *Root) removeXattr(name, key string) error {
+	f, err := r.openXattrTarget(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.Fremovexattr(int(f.Fd()), xattrPrefix+key); err != nil && err != unix.ENODATA {
+		return &os.PathError{Op: "removexattr", Path: name, Err: err}
+	}
+	return nil
+}
+
+// openXattrTarget opens name for attribute access. O_PATH descriptors cannot
+// carry xattrs, and O_NONBLOCK keeps a FIFO from blocking the open.
+func (r *Root) openXattrTarget(name string) (*os.File, error) {
+	return r.openFile(name, os.O_RDONLY|unix.O_NONBLOCK, 0)
+}
@@ -0,0 +1,61 @@
+//go:build !linux
+
+package fsops
+
+import (
+	"errors"
+	"os"
+)
+
+// statMeta reports what os.FileInfo offers portably. Inode numbers, link
+// counts, access, change and birth times are left zero.
+func (r *Root) statMeta(name string) (*FileMeta, error) {
+	info, err := r.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return infoMeta(info), nil
+}
+
+func (r *Root) lstatMeta(name string) (*FileMeta, error) {
+	info, err := r.lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	return infoMeta(info), nil
+}
+
+func infoMeta(info os.FileInfo) *FileMeta {
+	return &FileMeta{
+		Size:     info.Size(),
+		Mode:     info.Mode(),
+		RawMode:  unixMode(info.Mode()),
+		Modified: info.ModTime(),
+	}
+}
+
+func (r *Root) getXattr(name, key string) (string, error) {
+	return "", &os.PathError{Op: "getxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func (r *Root) setXattr(name, key, value string) error {
+	return &os.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func (r *Root) removeXattr(name, key string) error {
+	return &os.PathError{Op: "removexattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+// unixMode rebuilds st_mode from the permission and type bits of mode.
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		m |= 0o040000
+	case mode&os.ModeSymlink != 0:
+		m |= 0o120000
+	case mode.IsRegular():
+		m |= 0o100000
+	}
+	return m
+}
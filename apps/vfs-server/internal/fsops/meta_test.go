@@ -0,0 +1,90 @@
+package fsops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHashAttrRequiresMatchingModTime(t *testing.T) {
+	modified := time.Unix(1700000000, 123456789)
+	attr := FormatHashAttr([]byte{0xab, 0xcd}, modified)
+
+	if digest, ok := ParseHashAttr(attr, modified); !ok || digest != "abcd" {
+		t.Fatalf("ParseHashAttr = %q, %v", digest, ok)
+	}
+	if _, ok := ParseHashAttr(attr, modified.Add(time.Nanosecond)); ok {
+		t.Fatal("expected a hash for another modification time to be rejected")
+	}
+	for _, bad := range []string{"", "abcd", "zz 1700000000123456789", "abcd notanumber"} {
+		if _, ok := ParseHashAttr(bad, modified); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestStatMeta(t *testing.T) {
+	root, _ := newTestRoot(t)
+	name := filepath.Join(root.Path(), "docs", "a.txt")
+	if err := root.Link(name, filepath.Join(root.Path(), "a-hard.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := root.StatMeta(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != 5 || !meta.Mode.IsRegular() || meta.RawMode&0o170000 != 0o100000 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	info, _ := os.Stat(name)
+	if !meta.Modified.Equal(info.ModTime()) {
+		t.Fatalf("Modified = %v, want %v", meta.Modified, info.ModTime())
+	}
+	if runtime.GOOS == "linux" && (meta.Inode == 0 || meta.Nlink != 2) {
+		t.Fatalf("expected inode and two links, got %d, %d", meta.Inode, meta.Nlink)
+	}
+
+	if _, err := root.StatMeta(filepath.Join(root.Path(), "escape", "secret.txt")); !errors.Is(err, ErrSymlink) {
+		t.Fatalf("expected ErrSymlink, got %v", err)
+	}
+
+	link := filepath.Join(root.Path(), "docs", "secret-link")
+	if _, err := root.StatMeta(link); !errors.Is(err, ErrSymlink) {
+		t.Fatalf("StatMeta of a link: expected ErrSymlink, got %v", err)
+	}
+	linkMeta, err := root.LstatMeta(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkInfo, _ := os.Lstat(link)
+	if linkMeta.Mode&os.ModeSymlink == 0 || linkMeta.Size != linkInfo.Size() {
+		t.Fatalf("expected the link itself, got %+v", linkMeta)
+	}
+}
+
+func TestXattrRoundTrip(t *testing.T) {
+	root, _ := newTestRoot(t)
+	name := filepath.Join(root.Path(), "docs", "a.txt")
+
+	err := root.SetXattr(name, XattrSHA256, "value")
+	if errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.ENOTSUP) {
+		t.Skip("user xattrs are not supported here")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := root.GetXattr(name, XattrSHA256); err != nil || v != "value" {
+		t.Fatalf("GetXattr = %q, %v", v, err)
+	}
+	if err := root.RemoveXattr(name, XattrSHA256); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.GetXattr(name, XattrSHA256); err == nil {
+		t.Fatal("expected the attribute to be gone")
+	}
+}
@@ -1,38 +1,394 @@
 package fsops
 
 import (
+	"archive/zip"
+	"io"
+	"mime"
+	"net/http"
 	"path/filepath"
 	"strings"
 )
 
 var mimeMap = map[string]string{
-	"txt":  "text/plain",
-	"md":   "text/markdown",
-	"json": "application/json",
-	"csv":  "text/csv",
-	"html": "text/html",
-	"yaml": "text/yaml",
-	"yml":  "text/yaml",
-	"xml":  "text/xml",
+	// Text and data
+	"txt":      "text/plain",
+	"text":     "text/plain",
+	"log":      "text/plain",
+	"md":       "text/markdown",
+	"markdown": "text/markdown",
+	"mdx":      "text/mdx",
+	"rst":      "text/x-rst",
+	"tex":      "application/x-tex",
+	"json":     "application/json",
+	"jsonl":    "application/jsonl",
+	"ndjson":   "application/x-ndjson",
+	"geojson":  "application/geo+json",
+	"ipynb":    "application/x-ipynb+json",
+	"csv":      "text/csv",
+	"tsv":      "text/tab-separated-values",
+	"html":     "text/html",
+	"htm":      "text/html",
+	"css":      "text/css",
+	"yaml":     "text/yaml",
+	"yml":      "text/yaml",
+	"toml":     "application/toml",
+	"ini":      "text/plain",
+	"cfg":      "text/plain",
+	"conf":     "text/plain",
+	"env":      "text/plain",
+	"xml":      "text/xml",
+	"xsl":      "application/xslt+xml",
+	"rss":      "application/rss+xml",
+	"atom":     "application/atom+xml",
+	"ics":      "text/calendar",
+	"vcf":      "text/vcard",
+	"srt":      "application/x-subrip",
+	"vtt":      "text/vtt",
+	"diff":     "text/x-diff",
+	"patch":    "text/x-diff",
+	"sql":      "application/sql",
+	"graphql":  "application/graphql",
+	"proto":    "text/x-protobuf",
+
+	// Source code
+	"js":     "text/javascript",
+	"mjs":    "text/javascript",
+	"cjs":    "text/javascript",
+	"jsx":    "text/jsx",
+	"ts":     "text/x-typescript",
+	"mts":    "text/x-typescript",
+	"cts":    "text/x-typescript",
+	"tsx":    "text/tsx",
+	"py":     "text/x-python",
+	"pyi":    "text/x-python",
+	"rb":     "text/x-ruby",
+	"go":     "text/x-go",
+	"rs":     "text/x-rust",
+	"java":   "text/x-java",
+	"kt":     "text/x-kotlin",
+	"kts":    "text/x-kotlin",
+	"scala":  "text/x-scala",
+	"swift":  "text/x-swift",
+	"c":      "text/x-c",
+	"h":      "text/x-c",
+	"cc":     "text/x-c++",
+	"cpp":    "text/x-c++",
+	"cxx":    "text/x-c++",
+	"hpp":    "text/x-c++",
+	"cs":     "text/x-csharp",
+	"php":    "application/x-httpd-php",
+	"pl":     "text/x-perl",
+	"lua":    "text/x-lua",
+	"r":      "text/x-r",
+	"jl":     "text/x-julia",
+	"dart":   "text/x-dart",
+	"ex":     "text/x-elixir",
+	"exs":    "text/x-elixir",
+	"erl":    "text/x-erlang",
+	"hs":     "text/x-haskell",
+	"clj":    "text/x-clojure",
+	"ml":     "text/x-ocaml",
+	"vue":    "text/x-vue",
+	"svelte": "text/x-svelte",
+	"sh":     "application/x-sh",
+	"bash":   "application/x-sh",
+	"zsh":    "application/x-sh",
+	"fish":   "application/x-sh",
+	"ps1":    "text/x-powershell",
+	"bat":    "application/x-bat",
+	"scss":   "text/x-scss",
+	"sass":   "text/x-sass",
+	"less":   "text/x-less",
+	"mk":     "text/x-makefile",
+	"gradle": "text/x-gradle",
+	"tf":     "text/x-terraform",
+
+	// Images
 	"png":  "image/png",
+	"apng": "image/apng",
 	"jpg":  "image/jpeg",
 	"jpeg": "image/jpeg",
 	"gif":  "image/gif",
 	"webp": "image/webp",
 	"svg":  "image/svg+xml",
-	"pdf":  "application/pdf",
-	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
-	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
-	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
-	"zip":  "application/zip",
+	"bmp":  "image/bmp",
+	"ico":  "image/vnd.microsoft.icon",
+	"tif":  "image/tiff",
+	"tiff": "image/tiff",
+	"avif": "image/avif",
+	"heic": "image/heic",
+	"heif": "image/heif",
+	"psd":  "image/vnd.adobe.photoshop",
+
+	// Audio
+	"mp3":  "audio/mpeg",
+	"wav":  "audio/wav",
+	"ogg":  "audio/ogg",
+	"oga":  "audio/ogg",
+	"opus": "audio/opus",
+	"flac": "audio/flac",
+	"aac":  "audio/aac",
+	"m4a":  "audio/mp4",
+	"weba": "audio/webm",
+	"mid":  "audio/midi",
+	"midi": "audio/midi",
+	"aif":  "audio/aiff",
+	"aiff": "audio/aiff",
+
+	// Video
+	"mp4":  "video/mp4",
+	"m4v":  "video/mp4",
+	"mov":  "video/quicktime",
+	"webm": "video/webm",
+	"mkv":  "video/x-matroska",
+	"avi":  "video/x-msvideo",
+	"ogv":  "video/ogg",
+	"mpeg": "video/mpeg",
+	"mpg":  "video/mpeg",
+	"3gp":  "video/3gpp",
+
+	// Documents
+	"pdf":   "application/pdf",
+	"rtf":   "application/rtf",
+	"doc":   "application/msword",
+	"xls":   "application/vnd.ms-excel",
+	"ppt":   "application/vnd.ms-powerpoint",
+	"docx":  "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx":  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"xlsm":  "application/vnd.ms-excel.sheet.macroEnabled.12",
+	"pptx":  "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"odt":   "application/vnd.oasis.opendocument.text",
+	"ods":   "application/vnd.oasis.opendocument.spreadsheet",
+	"odp":   "application/vnd.oasis.opendocument.presentation",
+	"epub":  "application/epub+zip",
+	"pages": "application/vnd.apple.pages",
+	"key":   "application/vnd.apple.keynote",
+
+	// Archives
+	"zip": "application/zip",
+	"gz":  "application/gzip",
+	"tgz": "application/gzip",
+	"tar": "application/x-tar",
+	"bz2": "application/x-bzip2",
+	"xz":  "application/x-xz",
+	"zst": "application/zstd",
+	"7z":  "application/x-7z-compressed",
+	"rar": "application/vnd.rar",
+	"jar": "application/java-archive",
+
+	// Fonts
+	"ttf":   "font/ttf",
+	"otf":   "font/otf",
+	"woff":  "font/woff",
+	"woff2": "font/woff2",
+
+	// Data and binaries
+	"parquet": "application/vnd.apache.parquet",
+	"sqlite":  "application/vnd.sqlite3",
+	"db":      "application/vnd.sqlite3",
+	"wasm":    "application/wasm",
+	"pkl":     "application/octet-stream",
+	"npy":     "application/octet-stream",
+	"bin":     "application/octet-stream",
+}
+
+// sniffLen is how much of a file DetectContentType looks at; the tar header
+// magic sits at offset 257.
+const sniffLen = 512
+
+// signatures covers formats http.DetectContentType does not know.
+var signatures = []struct {
+	offset int
+	magic  string
+	mime   string
+}{
+	{0, "II*\x00", "image/tiff"},
+	{0, "MM\x00*", "image/tiff"},
+	{0, "8BPS", "image/vnd.adobe.photoshop"},
+	{0, "fLaC", "audio/flac"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+	{0, "PAR1", "application/vnd.apache.parquet"},
+	{0, "\x7fELF", "application/x-elf"},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage"},
+	{257, "ustar", "application/x-tar"},
+}
+
+// isoBrands maps ISO base media "ftyp" brands that are not video/mp4, which
+// is what http.DetectContentType reports for the whole family.
+var isoBrands = map[string]string{
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"M4A ": "audio/mp4",
+	"M4B ": "audio/mp4",
+	"qt  ": "video/quicktime",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+}
+
+// DetectContentType determines the MIME type of the file name from its
+// content, using the extension to refine or stand in for what the content
+// shows. Text gets the extension's type when that is a text type too, so
+// source files and JSON keep their specific types; content that is not text
+// never gets a text type from its extension. content is read from offset
+// zero up to size bytes; zip archives are opened to tell apart OOXML,
+// OpenDocument, EPUB and JAR files.
+func DetectContentType(name string, content io.ReaderAt, size int64) string {
+	head := make([]byte, min(size, sniffLen))
+	n, _ := content.ReadAt(head, 0)
+	head = head[:n]
+
+	byExt := ""
+	if ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")); ext != "" {
+		byExt = mimeMap[ext]
+	}
+	if len(head) == 0 {
+		if byExt != "" {
+			return byExt
+		}
+		return "text/plain"
+	}
+
+	for _, sig := range signatures {
+		if len(head) >= sig.offset+len(sig.magic) && string(head[sig.offset:sig.offset+len(sig.magic)]) == sig.magic {
+			if sig.mime == "application/x-ole-storage" {
+				// Legacy Office files share the OLE container.
+				if byExt != "" && isOLEType(byExt) {
+					return byExt
+				}
+				return "application/x-ole-storage"
+			}
+			return sig.mime
+		}
+	}
+
+	// bzip2: "BZh", the block size digit, then the block magic.
+	if len(head) >= 10 && string(head[:3]) == "BZh" && head[3] >= '1' && head[3] <= '9' && string(head[4:10]) == "1AY&SY" {
+		return "application/x-bzip2"
+	}
+
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if t, ok := isoBrands[string(head[8:12])]; ok {
+			return t
+		}
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	switch {
+	case sniffed == "application/zip":
+		return zipContentType(content, size, byExt)
+	case sniffed == "video/mp4":
+		if byExt == "audio/mp4" {
+			return byExt
+		}
+		return sniffed
+	case isTextType(sniffed):
+		if byExt != "" && isTextType(byExt) {
+			return byExt
+		}
+		return sniffed
+	case sniffed == "application/octet-stream":
+		return fallbackType(byExt)
+	}
+	return sniffed
 }
 
-// GetMimeType returns the MIME type for a file based on its extension.
-func GetMimeType(filePath string) string {
-	ext := strings.TrimPrefix(filepath.Ext(filePath), ".")
-	ext = strings.ToLower(ext)
-	if mime, ok := mimeMap[ext]; ok {
-		return mime
+// fallbackType is the extension's type for content that is not recognised
+// text, unless that would claim it is text.
+func fallbackType(byExt string) string {
+	if byExt != "" && !isTextType(byExt) {
+		return byExt
 	}
 	return "application/octet-stream"
 }
+
+// isTextType reports whether t is textual content, including XML and JSON
+// based application types and scripts.
+func isTextType(t string) bool {
+	switch {
+	case strings.HasPrefix(t, "text/"),
+		strings.HasSuffix(t, "+xml"), strings.HasSuffix(t, "+json"),
+		t == "application/json", t == "application/jsonl", t == "application/x-ndjson",
+		t == "application/toml", t == "application/sql", t == "application/graphql",
+		t == "application/x-sh", t == "application/x-bat", t == "application/x-tex",
+		t == "application/x-httpd-php", t == "application/x-subrip", t == "application/rtf":
+		return true
+	}
+	return false
+}
+
+func isOLEType(t string) bool {
+	switch t {
+	case "application/msword", "application/vnd.ms-excel", "application/vnd.ms-powerpoint":
+		return true
+	}
+	return false
+}
+
+// zipMimetypes are the values of a zip "mimetype" entry that identify a
+// format: the OpenDocument types and EPUB.
+var zipMimetypes = map[string]bool{
+	"application/epub+zip":                                     true,
+	"application/vnd.oasis.opendocument.text":                  true,
+	"application/vnd.oasis.opendocument.text-template":         true,
+	"application/vnd.oasis.opendocument.text-master":           true,
+	"application/vnd.oasis.opendocument.spreadsheet":           true,
+	"application/vnd.oasis.opendocument.spreadsheet-template":  true,
+	"application/vnd.oasis.opendocument.presentation":          true,
+	"application/vnd.oasis.opendocument.presentation-template": true,
+	"application/vnd.oasis.opendocument.graphics":              true,
+	"application/vnd.oasis.opendocument.graphics-template":     true,
+	"application/vnd.oasis.opendocument.chart":                 true,
+	"application/vnd.oasis.opendocument.formula":               true,
+	"application/vnd.oasis.opendocument.image":                 true,
+	"application/vnd.oasis.opendocument.database":              true,
+}
+
+// zipContentType looks inside a zip archive for the files that identify the
+// document formats built on it.
+func zipContentType(content io.ReaderAt, size int64, byExt string) string {
+	zr, err := zip.NewReader(content, size)
+	if err != nil {
+		return "application/zip"
+	}
+	names := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		names[f.Name] = f
+	}
+
+	if f, ok := names["mimetype"]; ok && f.UncompressedSize64 < 256 {
+		// ODF and EPUB store their type in an uncompressed first entry.
+		if rc, err := f.Open(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(rc, 256))
+			rc.Close()
+			// The entry is written by whoever made the file, so only the
+			// types the formats define are believed.
+			if t, _, err := mime.ParseMediaType(strings.TrimSpace(string(data))); err == nil && zipMimetypes[t] {
+				return t
+			}
+		}
+	}
+	if _, ok := names["[Content_Types].xml"]; ok {
+		switch {
+		case names["word/document.xml"] != nil:
+			return mimeMap["docx"]
+		case names["xl/workbook.xml"] != nil:
+			if byExt == mimeMap["xlsm"] {
+				return byExt
+			}
+			return mimeMap["xlsx"]
+		case names["ppt/presentation.xml"] != nil:
+			return mimeMap["pptx"]
+		}
+	}
+	if _, ok := names["META-INF/MANIFEST.MF"]; ok && byExt == mimeMap["jar"] {
+		return byExt
+	}
+	return "application/zip"
+}
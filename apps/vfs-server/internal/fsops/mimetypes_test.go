@@ -0,0 +1,76 @@
+package fsops
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func zipBytes(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("x"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// mimetypeZip is a zip whose first entry is a "mimetype" file holding value,
+// as ODF and EPUB files begin.
+func mimetypeZip(t *testing.T, value string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(value))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"report.bin", zipBytes(t, "[Content_Types].xml", "word/document.xml"), "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"sheet", zipBytes(t, "[Content_Types].xml", "xl/workbook.xml"), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"deck.zip", zipBytes(t, "[Content_Types].xml", "ppt/presentation.xml"), "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		{"archive.docx", zipBytes(t, "a.txt"), "application/zip"},
+		{"letter", mimetypeZip(t, "application/vnd.oasis.opendocument.text"), "application/vnd.oasis.opendocument.text"},
+		{"book.zip", mimetypeZip(t, "application/epub+zip\n"), "application/epub+zip"},
+		{"page.odt", mimetypeZip(t, "text/html"), "application/zip"},
+		{"bad.odt", mimetypeZip(t, "text/html\r\nX-Injected: 1"), "application/zip"},
+		{"picture.txt", png, "image/png"},
+		{"doc.dat", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"scan", append([]byte("II*\x00"), make([]byte, 16)...), "image/tiff"},
+		{"photo", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic"},
+		{"main.py", []byte("print('hi')\n"), "text/x-python"},
+		{"notebook.ipynb", []byte(`{"cells": []}`), "application/x-ipynb+json"},
+		{"notes", []byte("plain words\n"), "text/plain"},
+		{"latin1.txt", []byte("caf\xe9 au lait\n"), "text/plain"},
+		{"blob.py", []byte{0x00, 0x01, 0x02, 0xff}, "application/octet-stream"},
+		{"song.flac", []byte("fLaC\x00\x00\x00\x22"), "audio/flac"},
+		{"empty.json", nil, "application/json"},
+	}
+	for _, tt := range tests {
+		got := DetectContentType(tt.name, bytes.NewReader(tt.content), int64(len(tt.content)))
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,12 +2,20 @@ package fsops
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 )
 
+// RequestIDHeader carries the ID the server logs each request under. It is
+// echoed in every response and copied into error envelopes.
+const RequestIDHeader = "X-Request-Id"
+
 type ErrorBody struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 type Envelope struct {
@@ -27,6 +35,22 @@ func WriteError(w http.ResponseWriter, status int, code, message string) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(Envelope{
 		OK:    false,
-		Error: &ErrorBody{Code: code, Message: message},
+		Error: &ErrorBody{Code: code, Message: message, RequestID: w.Header().Get(RequestIDHeader)},
 	})
 }
+
+// WriteBodyError reports a failure to read or decode a request body: 413 when
+// the body exceeded the route's size limit, 408 when the client was too slow
+// sending it, and 400 with message otherwise.
+func WriteBodyError(w http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &tooLarge):
+		WriteError(w, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+	case errors.As(err, &netErr) && netErr.Timeout():
+		WriteError(w, http.StatusRequestTimeout, "REQUEST_TIMEOUT", "timed out reading request body")
+	default:
+		WriteError(w, http.StatusBadRequest, "BAD_REQUEST", message)
+	}
+}
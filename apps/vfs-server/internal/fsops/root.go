@@ -0,0 +1,299 @@
+package fsops
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/protean/vfs-server/internal/tracing"
+)
+
+var (
+	// ErrSymlink is returned when resolving a path would traverse a symbolic
+	// link.
+	ErrSymlink = errors.New("path traverses a symbolic link")
+	// ErrEscapes is returned when a path, or the target of a symlink being
+	// created, resolves outside the root.
+	ErrEscapes = errors.New("path escapes workspace root")
+)
+
+// Root is an open workspace directory. Every operation resolves its path
+// beneath the directory descriptor and refuses to traverse symbolic links, so
+// a link planted inside the workspace (by an extracted archive or a sandbox
+// sharing the volume) cannot redirect reads or writes elsewhere. Links can
+// still be created, read and removed as entries in their own right.
+//
+// Methods take absolute paths already checked with ResolveWithinRoot; they are
+// converted back to root-relative form before being resolved.
+type Root struct {
+	path string
+	dir  *os.File
+	// ctx parents the spans traced for each operation.
+	ctx context.Context
+}
+
+// WithContext returns a copy of r whose operations are traced as children of
+// the span in ctx. The copy shares r's descriptor; only r should be closed.
+func (r *Root) WithContext(ctx context.Context) *Root {
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+// Path returns the directory the root was opened at.
+func (r *Root) Path() string {
+	return r.path
+}
+
+// Close releases the directory descriptor.
+func (r *Root) Close() error {
+	return r.dir.Close()
+}
+
+// Open opens name for reading.
+func (r *Root) Open(name string) (f *os.File, err error) {
+	defer r.trace("Open", name, "")(&err)
+	return r.openFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens name with the given os.O_* flags.
+func (r *Root) OpenFile(name string, flag int, perm os.FileMode) (f *os.File, err error) {
+	defer r.trace("OpenFile", name, "")(&err)
+	return r.openFile(name, flag, perm)
+}
+
+// ReadFile returns the contents of name.
+func (r *Root) ReadFile(name string) (data []byte, err error) {
+	defer r.trace("ReadFile", name, "")(&err)
+	f, err := r.openFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err = io.ReadAll(f)
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// WriteFile writes data to name, creating or truncating it.
+func (r *Root) WriteFile(name string, data []byte, perm os.FileMode) (err error) {
+	defer r.trace("WriteFile", name, "")(&err)
+	return r.writeFile(name, data, perm, os.O_TRUNC)
+}
+
+// CreateFile writes data to a new file name. It fails with fs.ErrExist if
+// anything, including a dangling symlink, is already there.
+func (r *Root) CreateFile(name string, data []byte, perm os.FileMode) (err error) {
+	defer r.trace("CreateFile", name, "")(&err)
+	return r.writeFile(name, data, perm, os.O_EXCL)
+}
+
+func (r *Root) writeFile(name string, data []byte, perm os.FileMode, flag int) error {
+	f, err := r.openFile(name, os.O_WRONLY|os.O_CREATE|flag, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Lstat returns information about name without following a final symlink.
+func (r *Root) Lstat(name string) (info os.FileInfo, err error) {
+	defer r.trace("Lstat", name, "")(&err)
+	return r.lstat(name)
+}
+
+// Stat returns information about name. Links are never followed, so a final
+// symlink fails with ErrSymlink like one anywhere else along name.
+func (r *Root) Stat(name string) (info os.FileInfo, err error) {
+	defer r.trace("Stat", name, "")(&err)
+	return r.stat(name)
+}
+
+// StatMeta is like Stat but also reports inode, link count, access, change
+// and, where the kernel and filesystem record it, birth times.
+func (r *Root) StatMeta(name string) (meta *FileMeta, err error) {
+	defer r.trace("StatMeta", name, "")(&err)
+	return r.statMeta(name)
+}
+
+// LstatMeta is like StatMeta but describes a final symlink itself.
+func (r *Root) LstatMeta(name string) (meta *FileMeta, err error) {
+	defer r.trace("LstatMeta", name, "")(&err)
+	return r.lstatMeta(name)
+}
+
+// GetXattr returns the server attribute key (see the Xattr constants) of
+// name. It fails with errors.ErrUnsupported where xattrs are unavailable.
+func (r *Root) GetXattr(name, key string) (value string, err error) {
+	defer r.trace("GetXattr", name, "")(&err)
+	return r.getXattr(name, key)
+}
+
+// SetXattr stores value as the server attribute key of name.
+func (r *Root) SetXattr(name, key, value string) (err error) {
+	defer r.trace("SetXattr", name, "")(&err)
+	return r.setXattr(name, key, value)
+}
+
+// RemoveXattr deletes the server attribute key of name if it is set.
+func (r *Root) RemoveXattr(name, key string) (err error) {
+	defer r.trace("RemoveXattr", name, "")(&err)
+	return r.removeXattr(name, key)
+}
+
+// Readlink returns the target stored in the symlink name.
+func (r *Root) Readlink(name string) (target string, err error) {
+	defer r.trace("Readlink", name, "")(&err)
+	return r.readlink(name)
+}
+
+// Symlink creates name as a symlink to target, which must be relative and
+// resolve inside the root.
+func (r *Root) Symlink(target, name string) (err error) {
+	defer r.trace("Symlink", name, "")(&err)
+	return r.symlink(target, name)
+}
+
+// Link creates newname as a hard link to oldname. A symlink at oldname is
+// linked itself rather than followed.
+func (r *Root) Link(oldname, newname string) (err error) {
+	defer r.trace("Link", oldname, newname)(&err)
+	return r.link(oldname, newname)
+}
+
+// ReadDir returns the entries of the directory name sorted by filename.
+func (r *Root) ReadDir(name string) (entries []os.DirEntry, err error) {
+	defer r.trace("ReadDir", name, "")(&err)
+	return r.readDir(name)
+}
+
+// Mkdir creates the directory name. Its parent must already exist.
+func (r *Root) Mkdir(name string, perm os.FileMode) (err error) {
+	defer r.trace("Mkdir", name, "")(&err)
+	return r.mkdir(name, perm)
+}
+
+// MkdirAll creates name and any missing parents.
+func (r *Root) MkdirAll(name string, perm os.FileMode) (err error) {
+	defer r.trace("MkdirAll", name, "")(&err)
+	return r.mkdirAll(name, perm)
+}
+
+// RemoveAll removes name and everything below it. A symlink is removed
+// itself, never its target. Removing the root empties it. Like os.RemoveAll,
+// a missing name is not an error.
+func (r *Root) RemoveAll(name string) (err error) {
+	defer r.trace("RemoveAll", name, "")(&err)
+	return r.removeAll(name)
+}
+
+// Rename moves oldname to newname, replacing what is there. Links are moved
+// rather than followed.
+func (r *Root) Rename(oldname, newname string) (err error) {
+	defer r.trace("Rename", oldname, newname)(&err)
+	return r.rename(oldname, newname, false)
+}
+
+// RenameNoReplace is like Rename but fails with fs.ErrExist when newname
+// already exists.
+func (r *Root) RenameNoReplace(oldname, newname string) (err error) {
+	defer r.trace("RenameNoReplace", oldname, newname)(&err)
+	return r.rename(oldname, newname, true)
+}
+
+// trace starts a span for the operation op on name (and newName for two-path
+// operations), returning the function that ends it with the operation's
+// error. Paths are recorded relative to the root so traces don't carry host
+// paths. A missing file is an expected outcome for many callers and is
+// recorded as an attribute rather than a failure.
+func (r *Root) trace(op, name, newName string) func(*error) {
+	if r.ctx == nil {
+		return func(*error) {}
+	}
+	attrs := []attribute.KeyValue{attribute.String("vfs.path", r.tracePath(name))}
+	if newName != "" {
+		attrs = append(attrs, attribute.String("vfs.new_path", r.tracePath(newName)))
+	}
+	_, span := tracing.Start(r.ctx, "fs."+op, attrs...)
+	return func(errp *error) {
+		err := *errp
+		if os.IsNotExist(err) {
+			span.SetAttributes(attribute.Bool("vfs.not_found", true))
+			err = nil
+		}
+		tracing.End(span, err)
+	}
+}
+
+func (r *Root) tracePath(name string) string {
+	rel, err := filepath.Rel(r.path, name)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// rel converts name into a slash-free, root-relative path ("." for the root
+// itself).
+func (r *Root) rel(op, name string) (string, error) {
+	rel, err := filepath.Rel(r.path, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrEscapes}
+	}
+	return rel, nil
+}
+
+// splitRel returns the parent directory and final element of rel.
+func splitRel(rel string) (dir, base string) {
+	dir, base = filepath.Split(rel)
+	dir = filepath.Clean(dir)
+	return dir, base
+}
+
+// splitComponents splits a cleaned relative path into its elements.
+func splitComponents(rel string) []string {
+	var parts []string
+	for _, p := range strings.Split(filepath.ToSlash(rel), "/") {
+		if p != "" && p != "." {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// expandLink resolves a symlink target found below the directory dir (given
+// as its components) and reports whether the result stays inside the root.
+func expandLink(dir []string, target string) ([]string, bool) {
+	if filepath.IsAbs(target) {
+		return nil, false
+	}
+	joined := path.Join(path.Join(dir...), filepath.ToSlash(target))
+	if joined == ".." || strings.HasPrefix(joined, "../") {
+		return nil, false
+	}
+	return splitComponents(joined), true
+}
+
+// linkStaysBeneath reports whether a symlink created at rel with target would
+// resolve inside the root.
+func linkStaysBeneath(rel, target string) bool {
+	dir, _ := splitRel(rel)
+	_, ok := expandLink(splitComponents(dir), target)
+	return ok
+}
+
+func errRootItself(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: ErrWorkspaceRoot}
+}
@@ -0,0 +1,432 @@
+package fsops
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+const resolveFlags = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS
+
+// openat2Unsupported is set once the kernel reports openat2 as missing
+// (before 5.6, or filtered by a seccomp profile). Resolution then falls back
+// to opening one component at a time with O_NOFOLLOW.
+var openat2Unsupported atomic.Bool
+
+// OpenRoot opens the directory at path.
+func OpenRoot(path string) (*Root, error) {
+	path = filepath.Clean(path)
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: resolveErr(err)}
+	}
+	return &Root{path: path, dir: os.NewFile(uintptr(fd), path)}, nil
+}
+
+func (r *Root) dirfd() int {
+	return int(r.dir.Fd())
+}
+
+func (r *Root) openFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	rel, err := r.rel("open", name)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := openBeneath(r.dirfd(), rel, flag, uint32(perm.Perm()))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+func (r *Root) lstat(name string) (os.FileInfo, error) {
+	rel, err := r.rel("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	// An O_PATH|O_NOFOLLOW descriptor refers to the link itself.
+	fd, err := openBeneath(r.dirfd(), rel, unix.O_PATH|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), filepath.Base(name))
+	defer f.Close()
+	return f.Stat()
+}
+
+func (r *Root) stat(name string) (os.FileInfo, error) {
+	rel, err := r.rel("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	// Without O_NOFOLLOW a final link is refused like any other.
+	fd, err := openBeneath(r.dirfd(), rel, unix.O_PATH, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), filepath.Base(name))
+	defer f.Close()
+	return f.Stat()
+}
+
+func (r *Root) readlink(name string) (string, error) {
+	rel, err := r.rel("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	parent, base, err := r.openParent("readlink", name, rel)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(parent)
+
+	target, err := readlinkAt(parent, base)
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+func (r *Root) symlink(target, name string) error {
+	rel, err := r.rel("symlink", name)
+	if err != nil {
+		return err
+	}
+	if !linkStaysBeneath(rel, target) {
+		return &os.LinkError{Op: "symlink", Old: target, New: name, Err: ErrEscapes}
+	}
+	parent, base, err := r.openParent("symlink", name, rel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(parent)
+
+	if err := unix.Symlinkat(target, parent, base); err != nil {
+		return &os.LinkError{Op: "symlink", Old: target, New: name, Err: err}
+	}
+	return nil
+}
+
+func (r *Root) link(oldname, newname string) error {
+	oldRel, err := r.rel("link", oldname)
+	if err != nil {
+		return err
+	}
+	newRel, err := r.rel("link", newname)
+	if err != nil {
+		return err
+	}
+
+	oldParent, oldBase, err := r.openParent("link", oldname, oldRel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(oldParent)
+	newParent, newBase, err := r.openParent("link", newname, newRel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(newParent)
+
+	if err := unix.Linkat(oldParent, oldBase, newParent, newBase, 0); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (r *Root) readDir(name string) ([]os.DirEntry, error) {
+	f, err := r.openFile(name, os.O_RDONLY|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := f.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, err
+}
+
+func (r *Root) mkdir(name string, perm os.FileMode) error {
+	rel, err := r.rel("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return &os.PathError{Op: "mkdir", Path: name, Err: unix.EEXIST}
+	}
+	parent, base, err := r.openParent("mkdir", name, rel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(parent)
+
+	if err := unix.Mkdirat(parent, base, uint32(perm.Perm())); err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (r *Root) mkdirAll(name string, perm os.FileMode) error {
+	rel, err := r.rel("mkdir", name)
+	if err != nil {
+		return err
+	}
+	fd, err := walkDirs(r.dirfd(), rel, true, uint32(perm.Perm()))
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	unix.Close(fd)
+	return nil
+}
+
+func (r *Root) removeAll(name string) error {
+	rel, err := r.rel("remove", name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		if err := removeContents(r.dirfd()); err != nil {
+			return &os.PathError{Op: "remove", Path: name, Err: err}
+		}
+		return nil
+	}
+
+	parent, base, err := r.openParent("remove", name, rel)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer unix.Close(parent)
+
+	if err := removeAllAt(parent, base); err != nil && err != unix.ENOENT {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (r *Root) rename(oldname, newname string, noReplace bool) error {
+	oldRel, err := r.rel("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newRel, err := r.rel("rename", newname)
+	if err != nil {
+		return err
+	}
+
+	oldParent, oldBase, err := r.openParent("rename", oldname, oldRel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(oldParent)
+	newParent, newBase, err := r.openParent("rename", newname, newRel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(newParent)
+
+	if noReplace {
+		err = renameNoReplaceAt(oldParent, oldBase, newParent, newBase)
+	} else {
+		err = unix.Renameat(oldParent, oldBase, newParent, newBase)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// renameNoReplaceAt renames without replacing an existing destination. When
+// the kernel or filesystem lacks RENAME_NOREPLACE it checks first instead,
+// which is only safe because callers hold the path locks.
+func renameNoReplaceAt(oldParent int, oldBase string, newParent int, newBase string) error {
+	err := unix.Renameat2(oldParent, oldBase, newParent, newBase, unix.RENAME_NOREPLACE)
+	if err != unix.ENOSYS && err != unix.EINVAL {
+		return err
+	}
+	var st unix.Stat_t
+	switch err := unix.Fstatat(newParent, newBase, &st, unix.AT_SYMLINK_NOFOLLOW); err {
+	case nil:
+		return unix.EEXIST
+	case unix.ENOENT:
+	default:
+		return err
+	}
+	return unix.Renameat(oldParent, oldBase, newParent, newBase)
+}
+
+// openParent opens the directory containing rel as an O_PATH descriptor and
+// returns it with rel's final element.
+func (r *Root) openParent(op, name, rel string) (int, string, error) {
+	if rel == "." {
+		return -1, "", errRootItself(op, name)
+	}
+	dir, base := splitRel(rel)
+	fd, err := openBeneath(r.dirfd(), dir, unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return -1, "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return fd, base, nil
+}
+
+// openBeneath opens rel relative to dirfd without crossing a symlink or
+// leaving the directory.
+func openBeneath(dirfd int, rel string, flags int, perm uint32) (int, error) {
+	flags |= unix.O_CLOEXEC
+	if flags&(unix.O_CREAT|unix.O_TMPFILE) == 0 {
+		// openat2 rejects a mode without O_CREAT.
+		perm = 0
+	}
+
+	if !openat2Unsupported.Load() {
+		how := &unix.OpenHow{Flags: uint64(flags), Mode: uint64(perm), Resolve: resolveFlags}
+		for {
+			fd, err := unix.Openat2(dirfd, rel, how)
+			switch err {
+			case nil:
+				return fd, nil
+			case unix.EINTR, unix.EAGAIN:
+				// EAGAIN means a concurrent rename raced the lookup.
+				continue
+			case unix.ENOSYS:
+				openat2Unsupported.Store(true)
+			default:
+				return -1, resolveErr(err)
+			}
+			break
+		}
+	}
+
+	dir, base := splitRel(rel)
+	parent, err := walkDirs(dirfd, dir, false, 0)
+	if err != nil {
+		return -1, err
+	}
+	defer unix.Close(parent)
+
+	fd, err := unix.Openat(parent, base, flags|unix.O_NOFOLLOW, perm)
+	if err != nil {
+		if err == unix.ELOOP || (err == unix.ENOTDIR && isSymlinkAt(parent, base)) {
+			return -1, ErrSymlink
+		}
+		return -1, err
+	}
+	if flags&(unix.O_PATH|unix.O_NOFOLLOW) == unix.O_PATH {
+		// O_PATH|O_NOFOLLOW opens a link itself instead of failing; refuse
+		// it unless the caller asked for that.
+		var st unix.Stat_t
+		if err := unix.Fstat(fd, &st); err != nil || st.Mode&unix.S_IFMT == unix.S_IFLNK {
+			unix.Close(fd)
+			if err == nil {
+				err = ErrSymlink
+			}
+			return -1, err
+		}
+	}
+	return fd, nil
+}
+
+// walkDirs opens the directory rel below dirfd one component at a time with
+// O_NOFOLLOW, creating missing directories when mkdir is set. The caller
+// closes the returned descriptor.
+func walkDirs(dirfd int, rel string, mkdir bool, perm uint32) (int, error) {
+	cur, err := unix.Openat(dirfd, ".", unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	for _, name := range splitComponents(rel) {
+		if mkdir {
+			if err := unix.Mkdirat(cur, name, perm); err != nil && err != unix.EEXIST {
+				unix.Close(cur)
+				return -1, err
+			}
+		}
+		next, err := unix.Openat(cur, name, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			if err == unix.ENOTDIR && isSymlinkAt(cur, name) {
+				err = ErrSymlink
+			}
+			unix.Close(cur)
+			return -1, err
+		}
+		unix.Close(cur)
+		cur = next
+	}
+	return cur, nil
+}
+
+func isSymlinkAt(dirfd int, name string) bool {
+	var st unix.Stat_t
+	if err := unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return false
+	}
+	return st.Mode&unix.S_IFMT == unix.S_IFLNK
+}
+
+func readlinkAt(dirfd int, name string) (string, error) {
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(dirfd, name, buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// removeAllAt removes name below dirfd, recursing into directories without
+// following symlinks.
+func removeAllAt(dirfd int, name string) error {
+	err := unix.Unlinkat(dirfd, name, 0)
+	if err == nil || (err != unix.EISDIR && err != unix.EPERM) {
+		return err
+	}
+
+	fd, err := unix.Openat(dirfd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	err = removeContents(fd)
+	unix.Close(fd)
+	if err != nil {
+		return err
+	}
+	return unix.Unlinkat(dirfd, name, unix.AT_REMOVEDIR)
+}
+
+// removeContents removes every entry of the directory dirfd.
+func removeContents(dirfd int) error {
+	fd, err := unix.Openat(dirfd, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	dir := os.NewFile(uintptr(fd), ".")
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := removeAllAt(dirfd, name); err != nil && err != unix.ENOENT {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveErr translates the errors openat2 uses for refused resolutions.
+func resolveErr(err error) error {
+	switch err {
+	case unix.ELOOP:
+		return ErrSymlink
+	case unix.EXDEV:
+		return ErrEscapes
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+package fsops
+
+import "testing"
+
+func TestRootWithoutOpenat2(t *testing.T) {
+	openat2Unsupported.Store(true)
+	t.Cleanup(func() { openat2Unsupported.Store(false) })
+
+	runRootTests(t)
+}
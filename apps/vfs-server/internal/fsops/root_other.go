@@ -0,0 +1,174 @@
+//go:build !linux
+
+package fsops
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OpenRoot opens the directory at path.
+//
+// Without openat2 resolution falls back to Lstat-ing every component before
+// the operation. That rejects existing links but, unlike the Linux
+// implementation, cannot rule out one being swapped in concurrently.
+func OpenRoot(path string) (*Root, error) {
+	path = filepath.Clean(path)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrSymlink}
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Root{path: path, dir: dir}, nil
+}
+
+func (r *Root) openFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	if err := r.check("open", name, true); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(name, flag, perm)
+}
+
+func (r *Root) lstat(name string) (os.FileInfo, error) {
+	if err := r.check("lstat", name, false); err != nil {
+		return nil, err
+	}
+	return os.Lstat(name)
+}
+
+func (r *Root) readDir(name string) ([]os.DirEntry, error) {
+	if err := r.check("open", name, true); err != nil {
+		return nil, err
+	}
+	return os.ReadDir(name)
+}
+
+func (r *Root) mkdir(name string, perm os.FileMode) error {
+	if err := r.check("mkdir", name, false); err != nil {
+		return err
+	}
+	return os.Mkdir(name, perm)
+}
+
+func (r *Root) mkdirAll(name string, perm os.FileMode) error {
+	if err := r.check("mkdir", name, true); err != nil {
+		return err
+	}
+	return os.MkdirAll(name, perm)
+}
+
+func (r *Root) removeAll(name string) error {
+	if err := r.check("remove", name, false); err != nil {
+		return err
+	}
+	if filepath.Clean(name) != r.path {
+		return os.RemoveAll(name)
+	}
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(name, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Root) rename(oldname, newname string, noReplace bool) error {
+	if err := r.check("rename", oldname, false); err != nil {
+		return err
+	}
+	if err := r.check("rename", newname, false); err != nil {
+		return err
+	}
+	if filepath.Clean(oldname) == r.path {
+		return errRootItself("rename", oldname)
+	}
+	if noReplace {
+		// Not atomic; callers hold the path locks.
+		if _, err := os.Lstat(newname); err == nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrExist}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(oldname, newname)
+}
+
+func (r *Root) stat(name string) (os.FileInfo, error) {
+	if err := r.check("stat", name, true); err != nil {
+		return nil, err
+	}
+	return os.Stat(name)
+}
+
+func (r *Root) readlink(name string) (string, error) {
+	if err := r.check("readlink", name, false); err != nil {
+		return "", err
+	}
+	return os.Readlink(name)
+}
+
+func (r *Root) symlink(target, name string) error {
+	rel, err := r.rel("symlink", name)
+	if err != nil {
+		return err
+	}
+	if !linkStaysBeneath(rel, target) {
+		return &os.LinkError{Op: "symlink", Old: target, New: name, Err: ErrEscapes}
+	}
+	if err := r.check("symlink", name, false); err != nil {
+		return err
+	}
+	return os.Symlink(target, name)
+}
+
+func (r *Root) link(oldname, newname string) error {
+	if err := r.check("link", oldname, false); err != nil {
+		return err
+	}
+	if err := r.check("link", newname, false); err != nil {
+		return err
+	}
+	return os.Link(oldname, newname)
+}
+
+// check rejects name if any existing directory on the way to it, or the
+// final element when followFinal is set, is a symlink.
+func (r *Root) check(op, name string, followFinal bool) error {
+	rel, err := r.rel(op, name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	cur := r.path
+	for i, part := range parts {
+		cur = filepath.Join(cur, part)
+		if i == len(parts)-1 && !followFinal {
+			break
+		}
+		info, err := os.Lstat(cur)
+		if err != nil {
+			// Missing components are reported by the operation itself.
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return &os.PathError{Op: op, Path: name, Err: ErrSymlink}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package fsops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRoot returns an open root with a secret file outside it and a
+// symlink "escape" inside it pointing at the outside directory.
+func newTestRoot(t *testing.T) (*Root, string) {
+	t.Helper()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "docs", "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(base, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(base, "docs", "secret-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := OpenRoot(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { root.Close() })
+	return root, outside
+}
+
+func TestRoot(t *testing.T) {
+	runRootTests(t)
+}
+
+func runRootTests(t *testing.T) {
+	t.Run("reads regular files", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		data, err := root.ReadFile(filepath.Join(root.Path(), "docs", "a.txt"))
+		if err != nil || string(data) != "hello" {
+			t.Fatalf("ReadFile = %q, %v", data, err)
+		}
+	})
+
+	t.Run("refuses to read through a directory symlink", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		_, err := root.ReadFile(filepath.Join(root.Path(), "escape", "secret.txt"))
+		if !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+	})
+
+	t.Run("refuses to read a file symlink", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		_, err := root.ReadFile(filepath.Join(root.Path(), "docs", "secret-link"))
+		if !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+	})
+
+	t.Run("refuses to write through a symlink", func(t *testing.T) {
+		root, outside := newTestRoot(t)
+		err := root.WriteFile(filepath.Join(root.Path(), "escape", "planted.txt"), []byte("x"), 0o644)
+		if !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+		err = root.WriteFile(filepath.Join(root.Path(), "docs", "secret-link"), []byte("x"), 0o644)
+		if !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "planted.txt")); !os.IsNotExist(err) {
+			t.Fatal("file was created outside the root")
+		}
+		if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "secret" {
+			t.Fatalf("target outside the root was modified: %q", data)
+		}
+	})
+
+	t.Run("refuses to create directories through a symlink", func(t *testing.T) {
+		root, outside := newTestRoot(t)
+		err := root.MkdirAll(filepath.Join(root.Path(), "escape", "nested", "dir"), 0o755)
+		if !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "nested")); !os.IsNotExist(err) {
+			t.Fatal("directory was created outside the root")
+		}
+	})
+
+	t.Run("refuses to follow links inside the root", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		if err := root.Symlink("docs", filepath.Join(root.Path(), "docs-link")); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(root.Path(), "docs-link")
+
+		if _, err := root.ReadFile(filepath.Join(link, "a.txt")); !errors.Is(err, ErrSymlink) {
+			t.Fatalf("ReadFile through link: expected ErrSymlink, got %v", err)
+		}
+		if err := root.MkdirAll(filepath.Join(link, "sub"), 0o755); !errors.Is(err, ErrSymlink) {
+			t.Fatalf("MkdirAll through link: expected ErrSymlink, got %v", err)
+		}
+		if _, err := root.Stat(link); !errors.Is(err, ErrSymlink) {
+			t.Fatalf("Stat of link: expected ErrSymlink, got %v", err)
+		}
+		target, err := root.Readlink(link)
+		if err != nil || target != "docs" {
+			t.Fatalf("Readlink = %q, %v", target, err)
+		}
+	})
+
+	t.Run("refuses to create links that leave the root", func(t *testing.T) {
+		root, outside := newTestRoot(t)
+		for _, target := range []string{outside, "../../outside", "../docs/../../outside"} {
+			err := root.Symlink(target, filepath.Join(root.Path(), "docs", "bad-link"))
+			if !errors.Is(err, ErrEscapes) {
+				t.Errorf("Symlink(%q): expected ErrEscapes, got %v", target, err)
+			}
+		}
+	})
+
+	t.Run("hard links share content", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		if err := root.Link(filepath.Join(root.Path(), "docs", "a.txt"), filepath.Join(root.Path(), "a-hard.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.WriteFile(filepath.Join(root.Path(), "a-hard.txt"), []byte("changed"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := root.ReadFile(filepath.Join(root.Path(), "docs", "a.txt")); string(data) != "changed" {
+			t.Fatalf("expected hard link to share content, got %q", data)
+		}
+	})
+
+	t.Run("lstat reports the link itself", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		info, err := root.Lstat(filepath.Join(root.Path(), "escape"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 || info.IsDir() {
+			t.Fatalf("expected a symlink, got mode %v", info.Mode())
+		}
+		if _, err := root.Lstat(filepath.Join(root.Path(), "escape", "secret.txt")); !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink below a link, got %v", err)
+		}
+	})
+
+	t.Run("remove deletes links without touching their targets", func(t *testing.T) {
+		root, outside := newTestRoot(t)
+		if err := root.RemoveAll(filepath.Join(root.Path(), "escape")); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.RemoveAll(filepath.Join(root.Path(), "docs")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Lstat(filepath.Join(root.Path(), "docs")); !os.IsNotExist(err) {
+			t.Fatal("expected docs to be removed")
+		}
+		if _, err := os.Stat(filepath.Join(outside, "secret.txt")); err != nil {
+			t.Fatalf("target outside the root was removed: %v", err)
+		}
+	})
+
+	t.Run("remove of a missing path succeeds", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		if err := root.RemoveAll(filepath.Join(root.Path(), "missing", "file")); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	})
+
+	t.Run("rename moves files and refuses link parents", func(t *testing.T) {
+		root, outside := newTestRoot(t)
+		from := filepath.Join(root.Path(), "docs", "a.txt")
+		to := filepath.Join(root.Path(), "b.txt")
+		if err := root.Rename(from, to); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile(to); err != nil || string(data) != "hello" {
+			t.Fatalf("renamed file = %q, %v", data, err)
+		}
+
+		err := root.Rename(to, filepath.Join(root.Path(), "escape", "b.txt"))
+		if !errors.Is(err, ErrSymlink) {
+			t.Fatalf("expected ErrSymlink, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "b.txt")); !os.IsNotExist(err) {
+			t.Fatal("file was moved outside the root")
+		}
+	})
+
+	t.Run("rename without replace keeps an existing destination", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		from := filepath.Join(root.Path(), "b.txt")
+		to := filepath.Join(root.Path(), "docs", "a.txt")
+		if err := root.WriteFile(from, []byte("new"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.RenameNoReplace(from, to); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("expected ErrExist, got %v", err)
+		}
+		if data, _ := os.ReadFile(to); string(data) != "hello" {
+			t.Fatalf("destination was replaced: %q", data)
+		}
+		if err := root.RenameNoReplace(from, filepath.Join(root.Path(), "c.txt")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("create and mkdir refuse existing entries", func(t *testing.T) {
+		root, _ := newTestRoot(t)
+		if err := root.CreateFile(filepath.Join(root.Path(), "docs", "a.txt"), []byte("x"), 0o644); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("CreateFile over a file: expected ErrExist, got %v", err)
+		}
+		dangling := filepath.Join(root.Path(), "docs", "dangling")
+		if err := root.Symlink("missing.txt", dangling); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.CreateFile(dangling, []byte("x"), 0o644); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("CreateFile over a dangling link: expected ErrExist, got %v", err)
+		}
+		if _, err := os.Lstat(filepath.Join(root.Path(), "docs", "missing.txt")); !os.IsNotExist(err) {
+			t.Fatal("CreateFile followed the dangling link")
+		}
+		if err := root.Mkdir(filepath.Join(root.Path(), "docs"), 0o755); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("Mkdir over a directory: expected ErrExist, got %v", err)
+		}
+		if err := root.Mkdir(filepath.Join(root.Path(), "new", "child"), 0o755); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Mkdir without parent: expected ErrNotExist, got %v", err)
+		}
+		if err := root.Mkdir(filepath.Join(root.Path(), "new"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rejects paths outside the root", func(t *testing.T) {
+		root, outside := newTestRoot(t)
+		_, err := root.ReadFile(filepath.Join(outside, "secret.txt"))
+		if !errors.Is(err, ErrEscapes) {
+			t.Fatalf("expected ErrEscapes, got %v", err)
+		}
+	})
+}
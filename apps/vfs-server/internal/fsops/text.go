@@ -0,0 +1,152 @@
+package fsops
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrBinary is returned by DecodeText for content that is not text.
+var ErrBinary = errors.New("file is binary")
+
+// Text encodings DecodeText reports.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "iso-8859-1"
+)
+
+// DecodedText is file content converted to UTF-8.
+type DecodedText struct {
+	Text     string
+	Encoding string
+	// BOM reports whether the content started with a byte order mark. It is
+	// not included in Text.
+	BOM bool
+}
+
+// DecodeText converts data to UTF-8. A byte order mark decides the encoding
+// when there is one; otherwise data is taken as UTF-8 if valid, UTF-16 if
+// its zero bytes fall on alternate positions the way ASCII-range UTF-16 text
+// does, and Latin-1 failing both. Content with other zero bytes or mostly
+// control characters is ErrBinary.
+func DecodeText(data []byte) (DecodedText, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		rest := data[3:]
+		if !utf8.Valid(rest) {
+			return DecodedText{}, ErrBinary
+		}
+		return DecodedText{Text: string(rest), Encoding: EncodingUTF8, BOM: true}, nil
+	case bytes.HasPrefix(data, []byte("\xff\xfe\x00\x00")), bytes.HasPrefix(data, []byte("\x00\x00\xfe\xff")):
+		// UTF-32 is rare enough not to transcode.
+		return DecodedText{}, ErrBinary
+	case bytes.HasPrefix(data, []byte("\xff\xfe")):
+		return decodeUTF16(data[2:], false, true)
+	case bytes.HasPrefix(data, []byte("\xfe\xff")):
+		return decodeUTF16(data[2:], true, true)
+	}
+
+	if bytes.IndexByte(data, 0) >= 0 {
+		if bigEndian, ok := guessUTF16(data); ok {
+			return decodeUTF16(data, bigEndian, false)
+		}
+		return DecodedText{}, ErrBinary
+	}
+	if mostlyControl(data) {
+		return DecodedText{}, ErrBinary
+	}
+	if utf8.Valid(data) {
+		return DecodedText{Text: string(data), Encoding: EncodingUTF8}, nil
+	}
+
+	// Latin-1 maps every byte to the code point of the same value.
+	var b strings.Builder
+	b.Grow(len(data) + len(data)/8)
+	for _, c := range data {
+		b.WriteRune(rune(c))
+	}
+	return DecodedText{Text: b.String(), Encoding: EncodingLatin1}, nil
+}
+
+func decodeUTF16(data []byte, bigEndian, bom bool) (DecodedText, error) {
+	if len(data)%2 != 0 {
+		return DecodedText{}, ErrBinary
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	encoding := EncodingUTF16LE
+	if bigEndian {
+		encoding = EncodingUTF16BE
+	}
+	text := string(utf16.Decode(units))
+	if mostlyControl([]byte(text)) {
+		return DecodedText{}, ErrBinary
+	}
+	return DecodedText{Text: text, Encoding: encoding, BOM: bom}, nil
+}
+
+// guessUTF16 recognises BOM-less UTF-16 by its zero high bytes: at least
+// 40% of the bytes on one parity are zero and almost none on the other.
+func guessUTF16(data []byte) (bigEndian, ok bool) {
+	if len(data) < 4 || len(data)%2 != 0 {
+		return false, false
+	}
+	var even, odd int
+	for i, c := range data {
+		if c != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	half := len(data) / 2
+	switch {
+	case odd*10 >= half*4 && even*20 <= half:
+		return false, true
+	case even*10 >= half*4 && odd*20 <= half:
+		return true, true
+	}
+	return false, false
+}
+
+// mostlyControl reports whether more than a tenth of data is control bytes
+// other than common whitespace and escape.
+func mostlyControl(data []byte) bool {
+	control := 0
+	for _, c := range data {
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' && c != '\b' && c != 0x1b) || c == 0x7f {
+			control++
+		}
+	}
+	return control*10 > len(data)
+}
+
+// Newline styles NormalizeNewlines converts to.
+const (
+	NewlineLF   = "lf"
+	NewlineCRLF = "crlf"
+)
+
+// NormalizeNewlines rewrites CRLF, lone CR and LF line endings in s to the
+// given style.
+func NormalizeNewlines(s, style string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	if style == NewlineCRLF {
+		s = strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	return s
+}
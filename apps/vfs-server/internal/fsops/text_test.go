@@ -0,0 +1,54 @@
+package fsops
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		text     string
+		encoding string
+		bom      bool
+	}{
+		{"utf-8", "héllo\n", "héllo\n", EncodingUTF8, false},
+		{"utf-8 with bom", "\xef\xbb\xbfhi", "hi", EncodingUTF8, true},
+		{"utf-16le with bom", "\xff\xfeh\x00\xe9\x00", "hé", EncodingUTF16LE, true},
+		{"utf-16be with bom", "\xfe\xff\x00h\x00i", "hi", EncodingUTF16BE, true},
+		{"utf-16le without bom", "h\x00e\x00l\x00l\x00o\x00", "hello", EncodingUTF16LE, false},
+		{"latin-1", "caf\xe9", "café", EncodingLatin1, false},
+		{"empty", "", "", EncodingUTF8, false},
+	}
+	for _, tt := range tests {
+		got, err := DecodeText([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.Text != tt.text || got.Encoding != tt.encoding || got.BOM != tt.bom {
+			t.Errorf("%s: got %+v", tt.name, got)
+		}
+	}
+
+	for _, binary := range []string{
+		"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"\x7fELF\x02\x01\x01\x00\x00\x00",
+		"\x01\x02\x03\x04\x05abc",
+	} {
+		if _, err := DecodeText([]byte(binary)); !errors.Is(err, ErrBinary) {
+			t.Errorf("%q: expected ErrBinary, got %v", binary, err)
+		}
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	in := "a\r\nb\rc\nd"
+	if got := NormalizeNewlines(in, NewlineLF); got != "a\nb\nc\nd" {
+		t.Errorf("lf: got %q", got)
+	}
+	if got := NormalizeNewlines(in, NewlineCRLF); got != "a\r\nb\r\nc\r\nd" {
+		t.Errorf("crlf: got %q", got)
+	}
+}
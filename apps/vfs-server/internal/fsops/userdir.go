@@ -0,0 +1,130 @@
+package fsops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// User ID policies.
+const (
+	UserIDPolicyCharset = "charset"
+	UserIDPolicyUUID    = "uuid"
+)
+
+// Workspace directory layouts.
+const (
+	UserDirLayoutFlat    = "flat"
+	UserDirLayoutSharded = "sharded"
+)
+
+// ErrInvalidUserID is returned for user IDs that cannot safely be used as a
+// directory name.
+var ErrInvalidUserID = errors.New("invalid user id")
+
+var (
+	// DefaultUserIDPattern allows 8–128 characters of a conservative charset
+	// that cannot start with a dot.
+	DefaultUserIDPattern = `^[A-Za-z0-9][A-Za-z0-9._-]{7,127}$`
+
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// UserDirs maps user IDs to workspace directories under a base path.
+type UserDirs struct {
+	base    string
+	pattern *regexp.Regexp
+	sharded bool
+}
+
+// NewUserDirs creates a mapping for base. policy is UserIDPolicyCharset (with
+// pattern, or DefaultUserIDPattern if empty) or UserIDPolicyUUID; layout is
+// UserDirLayoutFlat ("<base>/<id>") or UserDirLayoutSharded
+// ("<base>/ab/cd/<id>", where abcd are the first hex digits of sha256(id)).
+func NewUserDirs(base, policy, pattern, layout string) (*UserDirs, error) {
+	u := &UserDirs{base: filepath.Clean(base)}
+
+	switch policy {
+	case "", UserIDPolicyCharset:
+		if pattern == "" {
+			pattern = DefaultUserIDPattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id pattern: %w", err)
+		}
+		u.pattern = re
+	case UserIDPolicyUUID:
+		u.pattern = uuidPattern
+	default:
+		return nil, fmt.Errorf("unknown user id policy %q", policy)
+	}
+
+	switch layout {
+	case "", UserDirLayoutFlat:
+	case UserDirLayoutSharded:
+		u.sharded = true
+	default:
+		return nil, fmt.Errorf("unknown user dir layout %q", layout)
+	}
+
+	return u, nil
+}
+
+// Base returns the workspace base directory.
+func (u *UserDirs) Base() string {
+	return u.base
+}
+
+// Validate checks id against the policy. Independently of the configured
+// pattern, IDs that could be interpreted as paths are always rejected.
+func (u *UserDirs) Validate(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, "/\\\x00") {
+		return ErrInvalidUserID
+	}
+	if !u.pattern.MatchString(id) {
+		return ErrInvalidUserID
+	}
+	return nil
+}
+
+// Root returns the workspace directory for id.
+func (u *UserDirs) Root(id string) (string, error) {
+	if err := u.Validate(id); err != nil {
+		return "", err
+	}
+	if !u.sharded {
+		return filepath.Join(u.base, id), nil
+	}
+	sum := sha256.Sum256([]byte(id))
+	shard := hex.EncodeToString(sum[:2])
+	return filepath.Join(u.base, shard[:2], shard[2:], id), nil
+}
+
+// Split maps an absolute path inside a user workspace back to the user ID and
+// the slash-separated workspace-relative path.
+func (u *UserDirs) Split(path string) (userID, rel string, ok bool) {
+	r, err := filepath.Rel(u.base, path)
+	if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", "", false
+	}
+
+	depth := 1
+	if u.sharded {
+		depth = 3
+	}
+	parts := strings.SplitN(filepath.ToSlash(r), "/", depth+1)
+	if len(parts) != depth+1 || parts[depth] == "" {
+		return "", "", false
+	}
+
+	userID = parts[depth-1]
+	if root, err := u.Root(userID); err != nil || filepath.Join(u.base, filepath.FromSlash(strings.Join(parts[:depth], "/"))) != root {
+		return "", "", false
+	}
+	return userID, parts[depth], true
+}
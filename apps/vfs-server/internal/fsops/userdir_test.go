@@ -0,0 +1,122 @@
+package fsops
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUserDirsValidate(t *testing.T) {
+	charset, err := NewUserDirs("/workspace", UserIDPolicyCharset, "", UserDirLayoutFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uuid, err := NewUserDirs("/workspace", UserIDPolicyUUID, "", UserDirLayoutFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permissive, err := NewUserDirs("/workspace", UserIDPolicyCharset, `.*`, UserDirLayoutFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		charset    bool
+		uuid       bool
+		permissive bool
+	}{
+		{"plain id", "user-12345678", true, false, true},
+		{"workos style", "user_01HXYZABCDEF", true, false, true},
+		{"uuid", "3f2b8c1e-9d4a-4b7e-8f00-1234567890ab", true, true, true},
+		{"too short", "abc", false, false, true},
+		{"traversal", "../../etc/xxxxxxxx", false, false, false},
+		{"slash", "abc/defghijk", false, false, false},
+		{"backslash", `abc\defghijk`, false, false, false},
+		{"dot dot", "..", false, false, false},
+		{"leading dot", ".hidden-user", false, false, true},
+		{"nul byte", "user-1234\x005678", false, false, false},
+		{"empty", "", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := charset.Validate(tt.id) == nil; got != tt.charset {
+				t.Errorf("charset policy Validate(%q) ok=%v, want %v", tt.id, got, tt.charset)
+			}
+			if got := uuid.Validate(tt.id) == nil; got != tt.uuid {
+				t.Errorf("uuid policy Validate(%q) ok=%v, want %v", tt.id, got, tt.uuid)
+			}
+			if got := permissive.Validate(tt.id) == nil; got != tt.permissive {
+				t.Errorf("permissive pattern Validate(%q) ok=%v, want %v", tt.id, got, tt.permissive)
+			}
+		})
+	}
+}
+
+func TestUserDirsRoot(t *testing.T) {
+	flat, _ := NewUserDirs("/workspace", "", "", UserDirLayoutFlat)
+	sharded, _ := NewUserDirs("/workspace", "", "", UserDirLayoutSharded)
+
+	root, err := flat.Root("user-12345678")
+	if err != nil || root != filepath.Join("/workspace", "user-12345678") {
+		t.Fatalf("flat Root = %q, %v", root, err)
+	}
+
+	root, err = sharded.Root("user-12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, _ := filepath.Rel("/workspace", root)
+	shard, id := filepath.Split(rel)
+	if id != "user-12345678" || len(shard) != len("ab/cd/") {
+		t.Fatalf("expected sharded root ab/cd/<id>, got %q", rel)
+	}
+
+	again, _ := sharded.Root("user-12345678")
+	if again != root {
+		t.Fatalf("sharding must be deterministic: %q != %q", again, root)
+	}
+
+	if _, err := flat.Root("../escape-me"); err == nil {
+		t.Fatal("expected Root to reject an unsafe id")
+	}
+}
+
+func TestUserDirsSplit(t *testing.T) {
+	for _, layout := range []string{UserDirLayoutFlat, UserDirLayoutSharded} {
+		t.Run(layout, func(t *testing.T) {
+			dirs, _ := NewUserDirs("/workspace", "", "", layout)
+			root, _ := dirs.Root("user-12345678")
+
+			userID, rel, ok := dirs.Split(filepath.Join(root, "docs", "a.txt"))
+			if !ok || userID != "user-12345678" || rel != "docs/a.txt" {
+				t.Fatalf("Split = %q, %q, %v", userID, rel, ok)
+			}
+
+			if _, _, ok := dirs.Split(root); ok {
+				t.Fatal("expected the workspace root itself not to split")
+			}
+			if _, _, ok := dirs.Split("/elsewhere/user-12345678/a.txt"); ok {
+				t.Fatal("expected a path outside the base not to split")
+			}
+		})
+	}
+
+	sharded, _ := NewUserDirs("/workspace", "", "", UserDirLayoutSharded)
+	if _, _, ok := sharded.Split("/workspace/zz/zz/user-12345678/a.txt"); ok {
+		t.Fatal("expected a path in the wrong shard not to split")
+	}
+}
+
+func TestNewUserDirsRejectsUnknownOptions(t *testing.T) {
+	if _, err := NewUserDirs("/workspace", "email", "", ""); err == nil {
+		t.Error("expected unknown policy to be rejected")
+	}
+	if _, err := NewUserDirs("/workspace", "", "", "nested"); err == nil {
+		t.Error("expected unknown layout to be rejected")
+	}
+	if _, err := NewUserDirs("/workspace", "", "([", ""); err == nil {
+		t.Error("expected invalid pattern to be rejected")
+	}
+}
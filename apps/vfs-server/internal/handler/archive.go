@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+)
+
+// Downloads hold a subtree read lock that blocks writes, so neither a
+// stalled client nor a slow one may keep it indefinitely.
+// archiveStallTimeout bounds how long a download may go without the client
+// accepting any data, and archiveMaxDuration how long it may take overall.
+const (
+	archiveStallTimeout = time.Minute
+	archiveMaxDuration  = 30 * time.Minute
+)
+
+var errArchiveStopped = errors.New("server shutting down")
+
+// Archive streams the file or directory at path as a zip or gzipped tar
+// (format=zip|tar.gz, default zip). Repeated include and exclude parameters
+// filter the entries by glob; see fsops.GlobFilter. Writes to the subtree
+// wait until the download finishes, so the archive is a consistent snapshot.
+func Archive(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
+
+		q := r.URL.Query()
+		format := q.Get("format")
+		if format == "" {
+			format = fsops.ArchiveZip
+		}
+		var contentType string
+		switch format {
+		case fsops.ArchiveZip:
+			contentType = "application/zip"
+		case fsops.ArchiveTarGz:
+			contentType = "application/gzip"
+		default:
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be zip or tar.gz")
+			return
+		}
+		filter := &fsops.GlobFilter{Include: q["include"], Exclude: q["exclude"]}
+		if err := filter.Validate(); err != nil {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid glob pattern")
+			return
+		}
+
+		resolved, err := resolvePath(r, root, q.Get("path"))
+		if err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		unlock := d.rlockSubtree(r, resolved)
+		defer unlock()
+
+		// Errors found before the first byte still get an envelope.
+		if _, err := fs.Lstat(resolved); err != nil {
+			writeFSError(w, r, err, "file or directory not found")
+			return
+		}
+
+		name := filepath.Base(resolved)
+		if resolved == filepath.Clean(root) {
+			name = "workspace"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": name + "." + format,
+		}))
+		w.WriteHeader(http.StatusOK)
+
+		sw := &stallWriter{w: w, rc: http.NewResponseController(w), end: time.Now().Add(archiveMaxDuration)}
+		// Shutdown waits for the read lock, so a download still running
+		// when the server drains is cut off rather than waited for.
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-d.Draining:
+				sw.stop()
+			case <-done:
+			}
+		}()
+
+		stats, err := fsops.WriteArchive(sw, fs, resolved, name, format, filter)
+		d.Metrics.AddBytesRead(int(stats.Bytes))
+		if err != nil {
+			// The status is sent; the unfinished archive tells the client
+			// something went wrong.
+			middleware.LogError(r, fmt.Errorf("archive: %w", err))
+		}
+	}
+}
+
+// stallWriter pushes the response's write deadline forward before every
+// write, so a download keeps going while it keeps moving, but never past end.
+type stallWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	end time.Time
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (s *stallWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return 0, errArchiveStopped
+	}
+	deadline := time.Now().Add(archiveStallTimeout)
+	if deadline.After(s.end) {
+		deadline = s.end
+	}
+	s.rc.SetWriteDeadline(deadline)
+	s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// stop fails the write in progress, if any, and every one after it.
+func (s *stallWriter) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.rc.SetWriteDeadline(time.Now())
+}
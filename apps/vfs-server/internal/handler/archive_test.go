@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveStopsWhenDraining(t *testing.T) {
+	d, serve := newTestDeps(t)
+	srv := httptest.NewServer(serve(Archive(d)))
+	defer srv.Close()
+
+	// Incompressible content larger than the socket buffers, so the handler
+	// is left blocked writing to a client that reads nothing.
+	root, _ := d.Users.Root(testUserID)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 32<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := os.WriteFile(filepath.Join(root, "big.bin"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?path=big.bin", nil)
+	req.Header.Set("X-User-Id", testUserID)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if d.Locker.Stats().SubtreeRead != 1 {
+		t.Fatal("expected the download to hold a read lock")
+	}
+
+	close(d.Draining)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Locker.Wait(ctx); err != nil {
+		t.Fatalf("read lock still held after draining: %v", err)
+	}
+}
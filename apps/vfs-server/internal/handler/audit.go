@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/journal"
+	"github.com/protean/vfs-server/internal/middleware"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// Audit returns the current user's journal entries, optionally filtered by
+// ?path= prefix and ?since= (RFC 3339), most recent ?limit= entries.
+func Audit(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.GetUserID(r.Context())
+		root := middleware.GetUserRoot(r.Context())
+
+		query := journal.Query{UserID: userID, Limit: defaultAuditLimit}
+
+		if p := r.URL.Query().Get("path"); p != "" {
+			resolved, err := resolvePath(r, root, p)
+			if err != nil {
+				writePathError(w, err)
+				return
+			}
+			query.Path = workspacePath(root, resolved)
+		} else if err := middleware.AuthorizePath(r.Context(), ""); err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		if s := r.URL.Query().Get("since"); s != "" {
+			since, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "since must be an RFC 3339 timestamp")
+				return
+			}
+			query.Since = since
+		}
+
+		if l := r.URL.Query().Get("limit"); l != "" {
+			limit, err := strconv.Atoi(l)
+			if err != nil || limit <= 0 || limit > maxAuditLimit {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "limit must be between 1 and 1000")
+				return
+			}
+			query.Limit = limit
+		}
+
+		entries, err := d.Journal.Find(query)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		if entries == nil {
+			entries = []journal.Entry{}
+		}
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"entries": entries,
+		})
+	}
+}
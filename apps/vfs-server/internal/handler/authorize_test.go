@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protean/vfs-server/internal/config"
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+)
+
+func TestHandlersConfinePathsToPrefixes(t *testing.T) {
+	d, serve := newTestDeps(t)
+	policies := map[string]config.Policy{
+		"memory": {
+			Scopes:       map[string]bool{config.ScopeRead: true, config.ScopeWrite: true, config.ScopeDelete: true},
+			PathPrefixes: []string{".threads"},
+		},
+	}
+	authorized := func(h http.Handler) http.Handler {
+		return middleware.ServiceAuth(map[string]string{"tok": "memory"})(
+			middleware.Authorize(policies)(serve(h)))
+	}
+
+	root, _ := d.Users.Root(testUserID)
+	if err := os.MkdirAll(filepath.Join(root, ".threads"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".threads", "t.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		handler     http.Handler
+		method, url string
+		body        string
+		want        int
+	}{
+		{"read inside prefix", ReadFile(d), http.MethodGet, "/read?path=.threads/t.json", "", http.StatusOK},
+		{"read outside prefix", ReadFile(d), http.MethodGet, "/read?path=docs/a.txt", "", http.StatusForbidden},
+		{"missing path means root", ListDir(d), http.MethodGet, "/readdir", "", http.StatusForbidden},
+		{"rename escaping prefix", Rename(d), http.MethodPatch, "/rename", `{"path":".threads/t.json","newPath":"docs/t.json"}`, http.StatusForbidden},
+		{"rename by name escaping prefix", Rename(d), http.MethodPatch, "/rename", `{"path":".threads","newName":"docs"}`, http.StatusForbidden},
+		{"extract source outside prefix", Extract(d, fsops.ExtractLimits{}), http.MethodPost, "/extract", `{"path":".threads/out","source":"docs/a.zip"}`, http.StatusForbidden},
+		{"traversal out of prefix", WriteFile(d), http.MethodPost, "/write", `{"path":".threads/../x.txt","content":""}`, http.StatusForbidden},
+		{"usage covers the whole workspace", Usage(d), http.MethodGet, "/usage", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer tok")
+			req.Header.Set("X-User-Id", testUserID)
+			rec := httptest.NewRecorder()
+			authorized(tt.handler).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+			if rec.Code == http.StatusForbidden {
+				var env struct {
+					Error struct{ Code string } `json:"error"`
+				}
+				json.Unmarshal(rec.Body.Bytes(), &env)
+				if env.Error.Code != "FORBIDDEN" {
+					t.Fatalf("expected FORBIDDEN error code, got %q", env.Error.Code)
+				}
+			}
+		})
+	}
+}
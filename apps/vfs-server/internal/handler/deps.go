@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/protean/vfs-server/internal/events"
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/journal"
+	"github.com/protean/vfs-server/internal/metrics"
+	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
+	"github.com/protean/vfs-server/internal/ratelimit"
+	"github.com/protean/vfs-server/internal/tracing"
+	"github.com/protean/vfs-server/internal/usertoken"
+	"github.com/protean/vfs-server/internal/webhook"
+)
+
+// Deps holds the shared state the handlers are built from.
+type Deps struct {
+	Users      *fsops.UserDirs
+	Locker     *fsops.PathLocker
+	Events     *events.Broker
+	Webhooks   *webhook.Store
+	Journal    *journal.Journal
+	UserTokens *usertoken.Verifier
+	Quota      *quota.Tracker
+	Limiter    *ratelimit.Limiter
+	Metrics    *metrics.Metrics
+	// Draining is closed when the server starts shutting down. Readiness
+	// then fails and event streams end so they don't hold up the drain.
+	Draining chan struct{}
+}
+
+// draining reports whether shutdown has started.
+func (d *Deps) draining() bool {
+	select {
+	case <-d.Draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// charge reserves delta against the caller's storage quota. It writes a 507
+// and returns false when a hard limit would be exceeded; past a soft limit the
+// change goes ahead with an X-Vfs-Quota-Warning header.
+func (d *Deps) charge(w http.ResponseWriter, r *http.Request, delta quota.Usage) bool {
+	if d.Quota == nil {
+		return true
+	}
+	usage, err := d.Quota.Charge(middleware.GetUserID(r.Context()), delta)
+	if errors.Is(err, quota.ErrExceeded) {
+		fsops.WriteError(w, http.StatusInsufficientStorage, "QUOTA_EXCEEDED", err.Error())
+		return false
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return false
+	}
+	if d.Quota.Limits().OverSoft(usage) {
+		w.Header().Set("X-Vfs-Quota-Warning", "soft storage limit exceeded")
+	}
+	return true
+}
+
+// refund gives back usage that was charged for, or freed by, a change.
+func (d *Deps) refund(r *http.Request, delta quota.Usage) {
+	if d.Quota == nil {
+		return
+	}
+	d.Quota.Charge(middleware.GetUserID(r.Context()), delta.Neg())
+}
+
+// resolvePath checks the client path p against the service's allowed
+// prefixes and against root lexically, tracing the resolution. Every path a
+// handler acts on goes through here, which is what confines services with
+// path prefixes; errors are written with writePathError.
+func resolvePath(r *http.Request, root, p string) (string, error) {
+	if err := middleware.AuthorizePath(r.Context(), p); err != nil {
+		return "", err
+	}
+	_, span := tracing.Start(r.Context(), "vfs.resolve", attribute.String("vfs.path", p))
+	resolved, err := fsops.ResolveWithinRoot(root, p)
+	tracing.End(span, err)
+	return resolved, err
+}
+
+// writePathError writes the 403 response for a path resolvePath refused.
+func writePathError(w http.ResponseWriter, err error) {
+	if errors.Is(err, middleware.ErrPathForbidden) {
+		fsops.WriteError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+		return
+	}
+	fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+}
+
+// lockExact takes exact-path locks on paths, tracing how long it waited.
+func (d *Deps) lockExact(r *http.Request, paths ...string) (unlock func()) {
+	return traceLock(r, fsops.LockKindExact, len(paths), func() func() {
+		return d.Locker.LockExact(paths...)
+	})
+}
+
+// lockSubtree takes subtree locks on paths, tracing how long it waited.
+func (d *Deps) lockSubtree(r *http.Request, paths ...string) (unlock func()) {
+	return traceLock(r, fsops.LockKindSubtree, len(paths), func() func() {
+		return d.Locker.LockSubtree(paths...)
+	})
+}
+
+// rlockSubtree takes shared subtree read locks on paths, tracing how long it
+// waited.
+func (d *Deps) rlockSubtree(r *http.Request, paths ...string) (unlock func()) {
+	return traceLock(r, fsops.LockKindSubtreeRead, len(paths), func() func() {
+		return d.Locker.RLockSubtree(paths...)
+	})
+}
+
+func traceLock(r *http.Request, kind string, n int, lock func() func()) func() {
+	_, span := tracing.Start(r.Context(), "vfs.lock",
+		attribute.String("vfs.lock.kind", kind),
+		attribute.Int("vfs.lock.paths", n),
+	)
+	start := time.Now()
+	unlock := lock()
+	span.SetAttributes(attribute.Float64("vfs.lock.wait_seconds", time.Since(start).Seconds()))
+	span.End()
+	return unlock
+}
+
+// publish reports a change to resolved (and oldResolved for renames) inside
+// the user's workspace root, attributed to the calling service.
+func (d *Deps) publish(r *http.Request, root, eventType, resolved, oldResolved string, isDir bool) {
+	if d.Events == nil {
+		return
+	}
+	e := events.Event{
+		Type:        eventType,
+		UserID:      middleware.GetUserID(r.Context()),
+		Service:     middleware.GetServiceName(r.Context()),
+		Path:        workspacePath(root, resolved),
+		IsDirectory: isDir,
+	}
+	if oldResolved != "" {
+		e.OldPath = workspacePath(root, oldResolved)
+	}
+	d.Events.Publish(e)
+}
+
+// annotate records the paths an operation touches for the audit journal.
+func annotate(r *http.Request, root, resolved, newResolved string) {
+	newPath := ""
+	if newResolved != "" {
+		newPath = workspacePath(root, newResolved)
+	}
+	journal.Annotate(r.Context(), workspacePath(root, resolved), newPath)
+}
+
+// workspacePath converts a resolved absolute path back into the
+// slash-separated workspace-relative form clients use.
+func workspacePath(root, resolved string) string {
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// formatTime renders t the way every timestamp in the API is rendered.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// writeFSError reports err from a workspace operation using the codes from
+// fsops.MapError. Missing paths get notFound as the message when it is set,
+// and errors with no client-facing meaning are reported as internal.
+func writeFSError(w http.ResponseWriter, r *http.Request, err error, notFound string) {
+	apiErr, ok := fsops.MapError(err)
+	if !ok {
+		writeInternalError(w, r, err)
+		return
+	}
+	if apiErr.Code == "NOT_FOUND" && notFound != "" {
+		apiErr.Message = notFound
+	}
+	fsops.WriteError(w, apiErr.Status, apiErr.Code, apiErr.Message)
+}
+
+// writeInternalError logs err against the request and returns a generic 500,
+// since OS and storage errors can name host paths.
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	middleware.LogError(r, err)
+	fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", "internal error")
+}
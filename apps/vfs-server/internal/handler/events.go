@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+)
+
+const eventsHeartbeat = 15 * time.Second
+
+// Events streams workspace changes under ?path= as Server-Sent Events. Clients
+// resume with the Last-Event-ID header (or ?lastEventId=); if the requested
+// point is no longer in history a "reset" event tells them to re-list.
+func Events(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.GetUserID(r.Context())
+		root := middleware.GetUserRoot(r.Context())
+
+		prefix := r.URL.Query().Get("path")
+		resolved, err := resolvePath(r, root, prefix)
+		if err != nil {
+			writePathError(w, err)
+			return
+		}
+		prefix = workspacePath(root, resolved)
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("lastEventId")
+		}
+		var afterID uint64
+		if lastID != "" {
+			afterID, err = strconv.ParseUint(strings.TrimSpace(lastID), 10, 64)
+			if err != nil {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid Last-Event-ID")
+				return
+			}
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", "streaming unsupported")
+			return
+		}
+
+		// The stream outlives the server's WriteTimeout; heartbeats detect
+		// dead clients instead.
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		sub, replay, complete := d.Events.Subscribe(userID, afterID)
+		defer d.Events.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if !complete {
+			writeSSE(w, "", "reset", map[string]string{"reason": "history unavailable"})
+		}
+		for _, e := range replay {
+			if scoped, ok := e.Scoped(prefix); ok {
+				writeSSE(w, strconv.FormatUint(scoped.ID, 10), scoped.Type, scoped)
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-d.Draining:
+				writeSSE(w, "", "reset", map[string]string{"reason": "server shutting down"})
+				flusher.Flush()
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			case e, ok := <-sub.C:
+				if !ok {
+					if sub.Lagged() {
+						writeSSE(w, "", "reset", map[string]string{"reason": "subscriber lagged"})
+						flusher.Flush()
+					}
+					return
+				}
+				scoped, ok := e.Scoped(prefix)
+				if !ok {
+					continue
+				}
+				writeSSE(w, strconv.FormatUint(scoped.ID, 10), scoped.Type, scoped)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, id, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
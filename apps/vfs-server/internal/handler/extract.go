@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/journal"
+	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
+)
+
+type extractRequest struct {
+	// Path is the directory to extract into, created if missing.
+	Path string `json:"path"`
+	// Source is an archive already in the workspace.
+	Source string `json:"source"`
+	Format string `json:"format"`
+	// CreateOnly, or Overwrite set to false, fails the extraction with
+	// ALREADY_EXISTS if any entry would replace an existing file.
+	CreateOnly bool  `json:"createOnly"`
+	Overwrite  *bool `json:"overwrite"`
+}
+
+// Extract unpacks a zip, tar or tar.gz into the directory at path. The
+// archive is either uploaded as the multipart file field, with the other
+// options as form fields, or named by source in a JSON body. The whole
+// archive is checked before anything is written, so an unsafe entry or one
+// over the limits fails the request cleanly.
+func Extract(d *Deps, limits fsops.ExtractLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
+
+		var req extractRequest
+		var archive io.ReaderAt
+		var size int64
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "multipart/form-data" {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				fsops.WriteBodyError(w, err, "invalid multipart form")
+				return
+			}
+			req.Path = r.FormValue("path")
+			req.Format = r.FormValue("format")
+			createOnly, err := formBool(r, "createOnly")
+			if err != nil {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+				return
+			}
+			req.CreateOnly = createOnly
+			if r.FormValue("overwrite") != "" {
+				v, err := formBool(r, "overwrite")
+				if err != nil {
+					fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+					return
+				}
+				req.Overwrite = &v
+			}
+			file, hdr, err := r.FormFile("file")
+			if err != nil {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "missing file field")
+				return
+			}
+			defer file.Close()
+			archive, size = file, hdr.Size
+		} else {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				fsops.WriteBodyError(w, err, "invalid request body")
+				return
+			}
+			if req.Source == "" {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "missing source")
+				return
+			}
+		}
+
+		noReplace, ok := replaceMode(w, req.CreateOnly, req.Overwrite)
+		if !ok {
+			return
+		}
+
+		resolved, err := resolvePath(r, root, req.Path)
+		if err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		// A workspace archive is locked with the target, so it cannot change
+		// between the plan the quota is charged from and the run.
+		locked := []string{resolved}
+		var source string
+		if archive == nil {
+			source, err = resolvePath(r, root, req.Source)
+			if err != nil {
+				writePathError(w, err)
+				return
+			}
+			locked = append(locked, source)
+		}
+
+		annotate(r, root, resolved, "")
+
+		unlock := d.lockSubtree(r, locked...)
+		defer unlock()
+
+		if archive == nil {
+			f, err := fs.Open(source)
+			if err != nil {
+				writeFSError(w, r, err, "archive not found")
+				return
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				writeFSError(w, r, err, "archive not found")
+				return
+			}
+			if info.IsDir() {
+				fsops.WriteError(w, http.StatusConflict, "IS_DIRECTORY", "source is a directory")
+				return
+			}
+			archive, size = f, info.Size()
+		}
+
+		format := req.Format
+		switch format {
+		case "":
+			format = fsops.DetectArchiveFormat(archive)
+			if format == "" {
+				fsops.WriteError(w, http.StatusBadRequest, "INVALID_ARCHIVE", "not a zip, tar or tar.gz archive")
+				return
+			}
+		case "tgz":
+			format = fsops.ArchiveTarGz
+		case fsops.ArchiveZip, fsops.ArchiveTar, fsops.ArchiveTarGz:
+		default:
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be zip, tar or tar.gz")
+			return
+		}
+
+		_, statErr := fs.Stat(resolved)
+		existed := statErr == nil
+
+		plan, err := fsops.PlanExtract(fs, resolved, archive, size, format, limits, noReplace)
+		if err != nil {
+			writeExtractError(w, r, err)
+			return
+		}
+
+		delta := quota.Usage{Bytes: plan.NetBytes, Files: plan.NewFiles}
+		if !d.charge(w, r, delta) {
+			return
+		}
+
+		stats, err := plan.Run()
+		journal.AddBytes(r.Context(), stats.Bytes)
+		d.Metrics.AddBytesWritten(int(stats.Bytes))
+		if stats.Entries > 0 {
+			d.publish(r, root, writeEventType(existed), resolved, "", true)
+		}
+		if err != nil {
+			// The entries before the failure stay, so only the part of the
+			// charge they did not use is refunded.
+			d.refund(r, quota.Usage{Bytes: delta.Bytes - plan.WrittenBytes, Files: delta.Files - plan.WrittenFiles})
+			writeExtractError(w, r, err)
+			return
+		}
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"path":        workspacePath(root, resolved),
+			"entries":     stats.Entries,
+			"files":       stats.Files,
+			"directories": stats.Dirs,
+			"symlinks":    stats.Symlinks,
+			"skipped":     stats.Skipped,
+			"bytes":       stats.Bytes,
+		})
+	}
+}
+
+// writeExtractError reports archive problems with the entry or limit at
+// fault, and anything else as a workspace error.
+func writeExtractError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fsops.ErrUnsafeEntry):
+		fsops.WriteError(w, http.StatusBadRequest, "UNSAFE_ARCHIVE_ENTRY", err.Error())
+	case errors.Is(err, fsops.ErrArchiveLimit):
+		fsops.WriteError(w, http.StatusRequestEntityTooLarge, "ARCHIVE_TOO_LARGE", err.Error())
+	case errors.Is(err, fsops.ErrInvalidArchive):
+		fsops.WriteError(w, http.StatusBadRequest, "INVALID_ARCHIVE", err.Error())
+	default:
+		writeFSError(w, r, err, "")
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
+)
+
+const testUserID = "user-12345678"
+
+// newTestDeps returns Deps with a quota tracker over a fresh workspace base,
+// and serves h as the test user.
+func newTestDeps(t *testing.T) (*Deps, func(h http.Handler) http.Handler) {
+	t.Helper()
+	dirs, err := fsops.NewUserDirs(t.TempDir(), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Deps{
+		Users:    dirs,
+		Locker:   fsops.NewPathLocker(),
+		Quota:    quota.NewTracker(dirs, quota.Limits{}),
+		Draining: make(chan struct{}),
+	}
+	return d, func(h http.Handler) http.Handler {
+		return middleware.UserContext(dirs, nil, false)(h)
+	}
+}
+
+func TestExtractRefundsOnlyWhatWasNotWritten(t *testing.T) {
+	d, serve := newTestDeps(t)
+	h := serve(Extract(d, fsops.ExtractLimits{}))
+
+	// The second entry's CRC is wrong, which only shows once its content is
+	// read, after the plan has been charged and the first entry written.
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range []string{"first.txt", "second.txt"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name + " content"))
+	}
+	zw.Close()
+	data := archive.Bytes()
+	data[bytes.LastIndex(data, []byte("second.txt content"))] ^= 0xff
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("path", "out")
+	fw, _ := mw.CreateFormFile("file", "a.zip")
+	fw.Write(data)
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/extract", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-User-Id", testUserID)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for the corrupt entry, got %d: %s", rec.Code, rec.Body)
+	}
+	root, _ := d.Users.Root(testUserID)
+	if _, err := os.Stat(filepath.Join(root, "out", "first.txt")); err != nil {
+		t.Fatalf("expected the first entry to stay: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "out", "second.txt")); !os.IsNotExist(err) {
+		t.Fatal("expected the partly written entry to be removed")
+	}
+	want := quota.Usage{Bytes: int64(len("first.txt content")), Files: 1}
+	if got := d.Quota.Tracked()[testUserID]; got != want {
+		t.Errorf("usage after the failed extraction: got %+v, want %+v", got, want)
+	}
+}
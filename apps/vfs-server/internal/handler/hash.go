@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+)
+
+// FileHash streams a file through the requested hash (sha256 by default,
+// or sha512, md5 or blake3) and returns the hex digest. SHA-256 is served
+// from the digest cached at write time while the file is unchanged; a read
+// never updates that cache.
+func FileHash(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
+
+		q := r.URL.Query()
+		algo := q.Get("algo")
+		if algo == "" {
+			algo = fsops.HashSHA256
+		}
+		h, ok := fsops.NewHash(algo)
+		if !ok {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "algo must be sha256, sha512, md5 or blake3")
+			return
+		}
+
+		resolved, err := resolvePath(r, root, q.Get("path"))
+		if err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		meta, err := fs.StatMeta(resolved)
+		if err != nil {
+			writeFSError(w, r, err, "file not found")
+			return
+		}
+		if meta.IsDir() {
+			fsops.WriteError(w, http.StatusConflict, "IS_DIRECTORY", "path is a directory")
+			return
+		}
+
+		if algo == fsops.HashSHA256 {
+			if attr, err := fs.GetXattr(resolved, fsops.XattrSHA256); err == nil {
+				if digest, ok := fsops.ParseHashAttr(attr, meta.Modified); ok {
+					fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+						"algo": algo,
+						"hash": digest,
+						"size": meta.Size,
+					})
+					return
+				}
+			}
+		}
+
+		f, err := fs.Open(resolved)
+		if err != nil {
+			writeFSError(w, r, err, "file not found")
+			return
+		}
+		defer f.Close()
+
+		n, err := io.Copy(h, f)
+		if err != nil {
+			writeFSError(w, r, err, "")
+			return
+		}
+		d.Metrics.AddBytesRead(int(n))
+		sum := h.Sum(nil)
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"algo": algo,
+			"hash": hex.EncodeToString(sum),
+			"size": n,
+		})
+	}
+}
+
+// checkUploadDigest verifies data against the X-Checksum header of r, which
+// describes the uploaded file rather than the request body. It writes the
+// error response and returns false on a malformed header or a mismatch.
+//
+// A Content-Digest header is refused rather than ignored: it covers the
+// request body, which is not the file, and a client sending it expects a
+// check that would otherwise silently not happen.
+func checkUploadDigest(w http.ResponseWriter, r *http.Request, data []byte) bool {
+	if r.Header.Get("Content-Digest") != "" {
+		fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "Content-Digest is not supported; send the file's digest as X-Checksum: algo:hex")
+		return false
+	}
+	c, ok, err := fsops.ParseChecksum(r.Header.Get("X-Checksum"))
+	if err != nil {
+		fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return false
+	}
+	if !ok {
+		return true
+	}
+	if err := fsops.VerifyChecksum(data, c); err != nil {
+		fsops.WriteError(w, http.StatusUnprocessableEntity, "CHECKSUM_MISMATCH", err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileChecksumHeaders(t *testing.T) {
+	d, serve := newTestDeps(t)
+	h := serve(WriteFile(d))
+	sum := sha256.Sum256([]byte("hello"))
+
+	tests := []struct {
+		name        string
+		header, val string
+		want        int
+		wantWritten bool
+	}{
+		{"matching X-Checksum", "X-Checksum", "sha256:" + hex.EncodeToString(sum[:]), http.StatusOK, true},
+		{"mismatched X-Checksum", "X-Checksum", "sha256:" + strings.Repeat("00", 32), http.StatusUnprocessableEntity, false},
+		{"Content-Digest is refused", "Content-Digest", "sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:", http.StatusBadRequest, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "f" + string(rune('a'+i)) + ".txt"
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/files/write", strings.NewReader(`{"path":"`+name+`","content":"hello"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-User-Id", testUserID)
+			req.Header.Set(tt.header, tt.val)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+
+			root, _ := d.Users.Root(testUserID)
+			_, err := os.Stat(filepath.Join(root, name))
+			if written := err == nil; written != tt.wantWritten {
+				t.Fatalf("written = %v, want %v", written, tt.wantWritten)
+			}
+		})
+	}
+}
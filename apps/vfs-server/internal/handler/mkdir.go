@@ -3,42 +3,80 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"os"
-	"path/filepath"
 
+	"github.com/protean/vfs-server/internal/events"
 	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
 )
 
 type mkdirRequest struct {
 	Path string `json:"path"`
+	// Exclusive fails with ALREADY_EXISTS when the directory already exists,
+	// like mkdir without -p.
+	Exclusive bool `json:"exclusive"`
+	// Parents creates missing parent directories. It defaults to true;
+	// without it a missing parent is NOT_FOUND.
+	Parents *bool `json:"parents"`
 }
 
-func MkDir(workspaceBase string, locker *fsops.PathLocker) http.HandlerFunc {
+func MkDir(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
 		var req mkdirRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
+			fsops.WriteBodyError(w, err, "invalid request body")
 			return
 		}
 
-		resolved, err := fsops.ResolveWithinRoot(root, req.Path)
+		resolved, err := resolvePath(r, root, req.Path)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
-		unlock := locker.LockExact(resolved)
+		annotate(r, root, resolved, "")
+
+		unlock := d.lockExact(r, resolved)
 		defer unlock()
 
-		if err := os.MkdirAll(resolved, 0o755); err != nil {
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		info, statErr := fs.Stat(resolved)
+		existed := statErr == nil
+		switch {
+		case existed && !info.IsDir():
+			fsops.WriteError(w, http.StatusConflict, "ALREADY_EXISTS", "a file already exists at path")
+			return
+		case existed && req.Exclusive:
+			fsops.WriteError(w, http.StatusConflict, "ALREADY_EXISTS", "directory already exists")
 			return
 		}
 
+		// Missing parents are picked up by the next reconcile.
+		var delta quota.Usage
+		if !existed {
+			delta.Files = 1
+		}
+		if !d.charge(w, r, delta) {
+			return
+		}
+
+		if req.Parents == nil || *req.Parents {
+			err = fs.MkdirAll(resolved, 0o755)
+		} else if !existed {
+			err = fs.Mkdir(resolved, 0o755)
+		}
+		if err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "parent directory not found")
+			return
+		}
+
+		if !existed {
+			d.publish(r, root, events.TypeCreate, resolved, "", true)
+		}
+
 		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"created": true,
 		})
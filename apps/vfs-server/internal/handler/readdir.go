@@ -9,34 +9,39 @@ import (
 	"github.com/protean/vfs-server/internal/middleware"
 )
 
-func ListDir(workspaceBase string, _ *fsops.PathLocker) http.HandlerFunc {
+func ListDir(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
 		dirPath := r.URL.Query().Get("path")
-		resolved, err := fsops.ResolveWithinRoot(root, dirPath)
+		resolved, err := resolvePath(r, root, dirPath)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
-		entries, err := os.ReadDir(resolved)
+		entries, err := fs.ReadDir(resolved)
 		if err != nil {
-			if os.IsNotExist(err) {
-				fsops.WriteError(w, http.StatusNotFound, "NOT_FOUND", "directory not found")
-				return
-			}
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+			writeFSError(w, r, err, "directory not found")
 			return
 		}
 
 		result := make([]map[string]interface{}, 0, len(entries))
 		for _, e := range entries {
-			result = append(result, map[string]interface{}{
+			entry := map[string]interface{}{
 				"name":        e.Name(),
 				"isDirectory": e.IsDir(),
-			})
+				"isSymlink":   false,
+			}
+			if e.Type()&os.ModeSymlink != 0 {
+				entryPath := filepath.Join(resolved, e.Name())
+				entry["isSymlink"] = true
+				if target, err := fs.Readlink(entryPath); err == nil {
+					entry["target"] = filepath.ToSlash(target)
+				}
+			}
+			result = append(result, entry)
 		}
 
 		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
@@ -1,38 +1,71 @@
 package handler
 
 import (
+	"encoding/base64"
+	"errors"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/middleware"
 )
 
-func ReadFile(workspaceBase string, _ *fsops.PathLocker) http.HandlerFunc {
+// ReadFile returns a file's content as UTF-8 text, transcoding UTF-16 and
+// Latin-1 and reporting the encoding it found. Binary files are refused with
+// BINARY_FILE unless the caller asks for them as base64 with binary=base64.
+// newline=lf or newline=crlf normalises line endings.
+func ReadFile(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
-		filePath := r.URL.Query().Get("path")
-		resolved, err := fsops.ResolveWithinRoot(root, filePath)
+		q := r.URL.Query()
+		binaryMode := q.Get("binary")
+		if binaryMode != "" && binaryMode != "error" && binaryMode != "base64" {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "binary must be error or base64")
+			return
+		}
+		newline := q.Get("newline")
+		if newline != "" && newline != fsops.NewlineLF && newline != fsops.NewlineCRLF {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "newline must be lf or crlf")
+			return
+		}
+
+		filePath := q.Get("path")
+		resolved, err := resolvePath(r, root, filePath)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
-		data, err := os.ReadFile(resolved)
+		data, err := fs.ReadFile(resolved)
 		if err != nil {
-			if os.IsNotExist(err) {
-				fsops.WriteError(w, http.StatusNotFound, "NOT_FOUND", "file not found")
+			writeFSError(w, r, err, "file not found")
+			return
+		}
+		d.Metrics.AddBytesRead(len(data))
+
+		decoded, err := fsops.DecodeText(data)
+		if errors.Is(err, fsops.ErrBinary) {
+			if binaryMode != "base64" {
+				fsops.WriteError(w, http.StatusUnsupportedMediaType, "BINARY_FILE", "file is binary; use read-binary or binary=base64")
 				return
 			}
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+			fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+				"content":  base64.StdEncoding.EncodeToString(data),
+				"encoding": "base64",
+				"bom":      false,
+			})
 			return
 		}
 
+		content := decoded.Text
+		if newline != "" {
+			content = fsops.NormalizeNewlines(content, newline)
+		}
 		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"content": string(data),
+			"content":  content,
+			"encoding": decoded.Encoding,
+			"bom":      decoded.BOM,
 		})
 	}
 }
@@ -1,38 +1,33 @@
 package handler
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
-	"os"
 	"path/filepath"
 
-	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/middleware"
 )
 
-func ReadFileBinary(workspaceBase string, _ *fsops.PathLocker) http.HandlerFunc {
+func ReadFileBinary(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
 		filePath := r.URL.Query().Get("path")
-		resolved, err := fsops.ResolveWithinRoot(root, filePath)
+		resolved, err := resolvePath(r, root, filePath)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
-		data, err := os.ReadFile(resolved)
+		data, err := fs.ReadFile(resolved)
 		if err != nil {
-			if os.IsNotExist(err) {
-				fsops.WriteError(w, http.StatusNotFound, "NOT_FOUND", "file not found")
-				return
-			}
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+			writeFSError(w, r, err, "file not found")
 			return
 		}
 
-		mimeType := fsops.GetMimeType(resolved)
+		mimeType := contentType(fs, resolved, bytes.NewReader(data), int64(len(data)))
 		fileName := filepath.Base(resolved)
 
 		w.Header().Set("Content-Type", mimeType)
@@ -40,5 +35,6 @@ func ReadFileBinary(workspaceBase string, _ *fsops.PathLocker) http.HandlerFunc
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
 		w.WriteHeader(http.StatusOK)
 		w.Write(data)
+		d.Metrics.AddBytesRead(len(data))
 	}
 }
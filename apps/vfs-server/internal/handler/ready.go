@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+// readyCheck is one line of the /readyz breakdown.
+type readyCheck struct {
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	FreeBytes     *uint64 `json:"freeBytes,omitempty"`
+	FreeInodes    *uint64 `json:"freeInodes,omitempty"`
+	MinFreeBytes  *uint64 `json:"minFreeBytes,omitempty"`
+	MinFreeInodes *uint64 `json:"minFreeInodes,omitempty"`
+}
+
+// readyCacheTTL is how long the volume checks of /readyz are reused. The
+// endpoint is unauthenticated and the writable check syncs a file, so each
+// request must not touch the disk.
+const readyCacheTTL = 5 * time.Second
+
+// Ready reports whether the server should receive traffic. Unlike /healthz,
+// which only shows the process is alive, it fails while the server is
+// draining for shutdown and when the workspace volume is missing, read-only
+// or short of space or inodes. The response lists every check either way.
+func Ready(d *Deps, minFreeBytes, minFreeInodes uint64) http.HandlerFunc {
+	var (
+		mu        sync.Mutex
+		checkedAt time.Time
+		volume    map[string]readyCheck
+	)
+	// volumeChecks runs the workspace checks at most once per readyCacheTTL;
+	// concurrent probes wait for the one in progress.
+	volumeChecks := func() map[string]readyCheck {
+		mu.Lock()
+		defer mu.Unlock()
+		if volume == nil || time.Since(checkedAt) >= readyCacheTTL {
+			base := d.Users.Base()
+			volume = map[string]readyCheck{
+				"workspace": checkWorkspaceDir(base),
+				"writable":  checkWritable(base),
+				"disk":      checkDiskSpace(base, minFreeBytes, minFreeInodes),
+			}
+			checkedAt = time.Now()
+		}
+		return volume
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]readyCheck{"draining": {OK: !d.draining()}}
+		for name, c := range volumeChecks() {
+			checks[name] = c
+		}
+
+		var failed []string
+		for _, name := range []string{"draining", "workspace", "writable", "disk"} {
+			if !checks[name].OK {
+				failed = append(failed, name)
+			}
+		}
+
+		data := map[string]interface{}{
+			"ready":  len(failed) == 0,
+			"checks": checks,
+		}
+		if len(failed) == 0 {
+			fsops.WriteJSON(w, http.StatusOK, data)
+			return
+		}
+
+		// Unlike other errors the breakdown is returned alongside, so probes
+		// and operators can see which check failed.
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(fsops.Envelope{
+			OK:   false,
+			Data: data,
+			Error: &fsops.ErrorBody{
+				Code:      "UNAVAILABLE",
+				Message:   "not ready: " + strings.Join(failed, ", "),
+				RequestID: w.Header().Get(fsops.RequestIDHeader),
+			},
+		})
+	}
+}
+
+func checkWorkspaceDir(base string) readyCheck {
+	info, err := os.Stat(base)
+	if err != nil {
+		return readyCheck{Error: readyErr(err)}
+	}
+	if !info.IsDir() {
+		return readyCheck{Error: "not a directory"}
+	}
+	return readyCheck{OK: true}
+}
+
+// checkWritable creates, syncs and removes a probe file in base. Files
+// directly in the base directory never belong to a workspace, so the probe
+// is invisible to users and the watcher.
+func checkWritable(base string) readyCheck {
+	f, err := os.CreateTemp(base, ".readyz-*")
+	if err != nil {
+		return readyCheck{Error: readyErr(err)}
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write([]byte("ok"))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return readyCheck{Error: readyErr(err)}
+	}
+	return readyCheck{OK: true}
+}
+
+func checkDiskSpace(base string, minFreeBytes, minFreeInodes uint64) readyCheck {
+	space, err := fsops.StatDisk(base)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return readyCheck{OK: true, Skipped: true}
+	}
+	if err != nil {
+		return readyCheck{Error: readyErr(err)}
+	}
+
+	c := readyCheck{
+		FreeBytes:     &space.FreeBytes,
+		MinFreeBytes:  &minFreeBytes,
+		MinFreeInodes: &minFreeInodes,
+	}
+	var problems []string
+	if space.FreeBytes < minFreeBytes {
+		problems = append(problems, "free space below threshold")
+	}
+	// Filesystems without an inode table report zero total inodes.
+	if space.TotalInodes > 0 {
+		c.FreeInodes = &space.FreeInodes
+		if space.FreeInodes < minFreeInodes {
+			problems = append(problems, "free inodes below threshold")
+		}
+	}
+	c.OK = len(problems) == 0
+	c.Error = strings.Join(problems, "; ")
+	return c
+}
+
+// readyErr describes err without the host path, since /readyz is served
+// without authentication.
+func readyErr(err error) string {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Op + ": " + pathErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type readyResponse struct {
+	Data struct {
+		Ready  bool                  `json:"ready"`
+		Checks map[string]readyCheck `json:"checks"`
+	} `json:"data"`
+}
+
+func getReady(t *testing.T, h http.Handler) (int, readyResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp readyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return rec.Code, resp
+}
+
+func TestReady(t *testing.T) {
+	d, _ := newTestDeps(t)
+	h := Ready(d, 0, 0)
+
+	code, resp := getReady(t, h)
+	if code != http.StatusOK || !resp.Data.Ready {
+		t.Fatalf("expected ready, got %d: %+v", code, resp.Data)
+	}
+	for _, name := range []string{"draining", "workspace", "writable", "disk"} {
+		if !resp.Data.Checks[name].OK {
+			t.Errorf("check %s failed: %+v", name, resp.Data.Checks[name])
+		}
+	}
+	entries, _ := os.ReadDir(d.Users.Base())
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".readyz-") {
+			t.Errorf("probe file %s was left behind", e.Name())
+		}
+	}
+
+	close(d.Draining)
+	code, resp = getReady(t, h)
+	if code != http.StatusServiceUnavailable || resp.Data.Ready || resp.Data.Checks["draining"].OK {
+		t.Fatalf("expected not ready while draining, got %d: %+v", code, resp.Data)
+	}
+}
+
+func TestReadyReusesVolumeChecks(t *testing.T) {
+	d, _ := newTestDeps(t)
+	h := Ready(d, 0, 0)
+
+	if code, _ := getReady(t, h); code != http.StatusOK {
+		t.Fatalf("expected ready, got %d", code)
+	}
+	// Within the cache lifetime the workspace is not looked at again, so its
+	// disappearance only shows on a later probe.
+	if err := os.RemoveAll(d.Users.Base()); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := getReady(t, h); code != http.StatusOK {
+		t.Fatalf("expected the cached result, got %d", code)
+	}
+
+	code, resp := getReady(t, Ready(d, 0, 0))
+	if code != http.StatusServiceUnavailable || resp.Data.Checks["workspace"].OK {
+		t.Fatalf("expected a fresh probe to fail, got %d: %+v", code, resp.Data)
+	}
+}
+
+func TestReadyDiskThresholds(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("free space is only reported on Linux")
+	}
+	d, _ := newTestDeps(t)
+
+	code, resp := getReady(t, Ready(d, math.MaxUint64, 0))
+	disk := resp.Data.Checks["disk"]
+	if code != http.StatusServiceUnavailable || disk.OK || disk.FreeBytes == nil {
+		t.Fatalf("expected the disk check to fail with free bytes reported, got %d: %+v", code, disk)
+	}
+	if *disk.MinFreeBytes != math.MaxUint64 {
+		t.Fatalf("expected the threshold in the breakdown, got %d", *disk.MinFreeBytes)
+	}
+}
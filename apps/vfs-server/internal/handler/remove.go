@@ -2,36 +2,50 @@ package handler
 
 import (
 	"net/http"
-	"os"
-	"path/filepath"
 
+	"github.com/protean/vfs-server/internal/events"
 	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
 )
 
-func Remove(workspaceBase string, locker *fsops.PathLocker) http.HandlerFunc {
+func Remove(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
 		filePath := r.URL.Query().Get("path")
-		resolved, err := fsops.ResolveWithinRoot(root, filePath)
+		resolved, err := resolvePath(r, root, filePath)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
-		unlock := locker.LockSubtree(resolved)
+		annotate(r, root, resolved, "")
+
+		unlock := d.lockSubtree(r, resolved)
 		defer unlock()
 
-		if err := os.RemoveAll(resolved); err != nil {
-			if os.IsNotExist(err) {
-				fsops.WriteError(w, http.StatusNotFound, "NOT_FOUND", "file or directory not found")
-				return
+		info, statErr := fs.Lstat(resolved)
+
+		var freed quota.Usage
+		if statErr == nil {
+			freed, _ = quota.Measure(resolved)
+			if resolved == root {
+				// Removing the root empties it but keeps the directory.
+				freed.Files--
 			}
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		}
+
+		if err := fs.RemoveAll(resolved); err != nil {
+			writeFSError(w, r, err, "file or directory not found")
 			return
 		}
+		d.refund(r, freed)
+
+		if statErr == nil {
+			d.publish(r, root, events.TypeDelete, resolved, "", info.IsDir())
+		}
 
 		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"removed": true,
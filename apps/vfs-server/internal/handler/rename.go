@@ -3,43 +3,53 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/protean/vfs-server/internal/events"
 	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
 )
 
 type renameRequest struct {
 	Path    string `json:"path"`
 	NewName string `json:"newName"`
 	NewPath string `json:"newPath"`
+	// CreateOnly, or Overwrite set to false, fails the rename with
+	// ALREADY_EXISTS instead of replacing an existing destination.
+	CreateOnly bool  `json:"createOnly"`
+	Overwrite  *bool `json:"overwrite"`
 }
 
-func Rename(workspaceBase string, locker *fsops.PathLocker) http.HandlerFunc {
+func Rename(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
 		var req renameRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
+			fsops.WriteBodyError(w, err, "invalid request body")
 			return
 		}
 
-		resolved, err := fsops.ResolveWithinRoot(root, req.Path)
+		noReplace, ok := replaceMode(w, req.CreateOnly, req.Overwrite)
+		if !ok {
+			return
+		}
+
+		resolved, err := resolvePath(r, root, req.Path)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
 		destinationResolved := ""
 		newPathInput := strings.TrimSpace(req.NewPath)
 		if newPathInput != "" {
-			destinationResolved, err = fsops.ResolveWithinRoot(root, newPathInput)
+			destinationResolved, err = resolvePath(r, root, newPathInput)
 			if err != nil {
-				fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+				writePathError(w, err)
 				return
 			}
 		} else {
@@ -52,33 +62,53 @@ func Rename(workspaceBase string, locker *fsops.PathLocker) http.HandlerFunc {
 			newPath := filepath.Join(filepath.Dir(resolved), newName)
 			relNewPath, err := filepath.Rel(root, newPath)
 			if err != nil {
-				fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+				writePathError(w, err)
 				return
 			}
 
-			destinationResolved, err = fsops.ResolveWithinRoot(root, relNewPath)
+			destinationResolved, err = resolvePath(r, root, relNewPath)
 			if err != nil {
-				fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+				writePathError(w, err)
 				return
 			}
 		}
 
-		unlock := locker.LockSubtree(resolved, destinationResolved)
+		if strings.HasPrefix(destinationResolved, resolved+string(filepath.Separator)) {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "cannot move a directory into itself")
+			return
+		}
+
+		annotate(r, root, resolved, destinationResolved)
+
+		unlock := d.lockSubtree(r, resolved, destinationResolved)
 		defer unlock()
 
-		if err := os.MkdirAll(filepath.Dir(destinationResolved), 0o755); err != nil {
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		if err := fs.MkdirAll(filepath.Dir(destinationResolved), 0o755); err != nil {
+			writeFSError(w, r, err, "")
 			return
 		}
 
-		if err := os.Rename(resolved, destinationResolved); err != nil {
-			if os.IsNotExist(err) {
-				fsops.WriteError(w, http.StatusNotFound, "NOT_FOUND", "file or directory not found")
-				return
-			}
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		// Renaming over an existing entry frees what it used.
+		var replaced quota.Usage
+		if _, err := fs.Lstat(destinationResolved); err == nil {
+			replaced, _ = quota.Measure(destinationResolved)
+		}
+
+		rename := fs.Rename
+		if noReplace {
+			rename = fs.RenameNoReplace
+		}
+		if err := rename(resolved, destinationResolved); err != nil {
+			writeFSError(w, r, err, "file or directory not found")
 			return
 		}
+		d.refund(r, replaced)
+
+		isDir := false
+		if info, err := fs.Lstat(destinationResolved); err == nil {
+			isDir = info.IsDir()
+		}
+		d.publish(r, root, events.TypeRename, destinationResolved, resolved, isDir)
 
 		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"renamed": true,
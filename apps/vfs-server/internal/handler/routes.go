@@ -5,37 +5,80 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/protean/vfs-server/internal/config"
 	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/middleware"
 )
 
 // NewRouter creates the chi router with all VFS routes.
-func NewRouter(workspaceBase string, tokens map[string]string) chi.Router {
+func NewRouter(d *Deps, cfg *config.Config) chi.Router {
 	r := chi.NewRouter()
-	locker := fsops.NewPathLocker()
+	r.Use(middleware.Trace)
+	r.Use(middleware.Metrics(d.Metrics))
 
-	// Health check — outside auth group
+	// Liveness and readiness checks — outside auth group
 	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	})
+	r.Get("/readyz", Ready(d, uint64(cfg.ReadyMinFreeBytes), uint64(cfg.ReadyMinFreeInodes)))
+	if d.Metrics != nil {
+		r.With(middleware.RequireToken(cfg.MetricsToken)).Get("/metrics", d.Metrics.Handler().ServeHTTP)
+	}
 
 	// Authenticated API routes
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.ServiceAuth(tokens))
-		r.Use(middleware.UserContext(workspaceBase))
-
-		r.Get("/api/v1/files/stat", Stat(workspaceBase, locker))
-		r.Get("/api/v1/files/readdir", ListDir(workspaceBase, locker))
-		r.Get("/api/v1/files/read", ReadFile(workspaceBase, locker))
-		r.Get("/api/v1/files/read-binary", ReadFileBinary(workspaceBase, locker))
-
-		r.Post("/api/v1/files/write", WriteFile(workspaceBase, locker))
-		r.Post("/api/v1/files/write-binary", WriteFileBinary(workspaceBase, locker))
-		r.Post("/api/v1/files/mkdir", MkDir(workspaceBase, locker))
-		r.Delete("/api/v1/files/remove", Remove(workspaceBase, locker))
-		r.Patch("/api/v1/files/rename", Rename(workspaceBase, locker))
+		r.Use(middleware.ServiceAuth(cfg.ServiceTokens))
+		r.Use(middleware.UserContext(d.Users, d.UserTokens, cfg.UserTokenRequired))
+		r.Use(middleware.RateLimit(d.Limiter))
+
+		policies := cfg.ServicePolicies
+
+		read := middleware.Authorize(policies, config.ScopeRead)
+		write := middleware.Authorize(policies, config.ScopeWrite)
+		remove := middleware.Authorize(policies, config.ScopeDelete)
+		move := middleware.Authorize(policies, config.ScopeWrite, config.ScopeDelete)
+
+		// Uploads get the binary limit; every other route, including ones
+		// that take no body, gets the JSON limit.
+		r.With(middleware.MaxBody(int64(cfg.MaxBinaryBody)), audit(d, "write"), write).Post("/api/v1/files/write-binary", WriteFileBinary(d))
+		r.With(middleware.MaxBody(int64(cfg.MaxBinaryBody)), audit(d, "extract"), write).Post("/api/v1/files/extract", Extract(d, fsops.ExtractLimits{
+			MaxEntries: cfg.ExtractMaxEntries,
+			MaxBytes:   int64(cfg.ExtractMaxBytes),
+			MaxRatio:   cfg.ExtractMaxRatio,
+		}))
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.MaxBody(int64(cfg.MaxJSONBody)))
+
+			r.With(read).Get("/api/v1/files/stat", Stat(d))
+			r.With(read).Get("/api/v1/files/readdir", ListDir(d))
+			r.With(read).Get("/api/v1/files/read", ReadFile(d))
+			r.With(read).Get("/api/v1/files/read-binary", ReadFileBinary(d))
+			r.With(read).Get("/api/v1/files/readlink", ReadLink(d))
+			r.With(read).Get("/api/v1/files/hash", FileHash(d))
+			r.With(read).Get("/api/v1/files/archive", Archive(d))
+
+			r.With(audit(d, "write"), write).Post("/api/v1/files/write", WriteFile(d))
+			r.With(audit(d, "mkdir"), write).Post("/api/v1/files/mkdir", MkDir(d))
+			r.With(audit(d, "symlink"), write).Post("/api/v1/files/symlink", Symlink(d))
+			r.With(audit(d, "link"), write).Post("/api/v1/files/link", Link(d))
+			r.With(audit(d, "remove"), remove).Delete("/api/v1/files/remove", Remove(d))
+			r.With(audit(d, "rename"), move).Patch("/api/v1/files/rename", Rename(d))
+
+			r.With(read).Get("/api/v1/events", Events(d))
+			r.With(read).Get("/api/v1/audit", Audit(d))
+			r.With(read).Get("/api/v1/usage", Usage(d))
+
+			r.With(read).Get("/api/v1/webhooks", ListWebhooks(d))
+			r.With(audit(d, "webhook.create"), write).Post("/api/v1/webhooks", CreateWebhook(d))
+			r.With(audit(d, "webhook.delete"), write).Delete("/api/v1/webhooks/{id}", DeleteWebhook(d))
+		})
 	})
 
 	return r
 }
+
+func audit(d *Deps, op string) func(http.Handler) http.Handler {
+	return middleware.Audit(d.Journal, op)
+}
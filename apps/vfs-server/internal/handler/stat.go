@@ -1,41 +1,81 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/protean/vfs-server/internal/fsops"
 	"github.com/protean/vfs-server/internal/middleware"
 )
 
-func Stat(workspaceBase string, _ *fsops.PathLocker) http.HandlerFunc {
+func Stat(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
 		filePath := r.URL.Query().Get("path")
-		resolved, err := fsops.ResolveWithinRoot(root, filePath)
+		resolved, err := resolvePath(r, root, filePath)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
-		info, err := os.Stat(resolved)
+		// Every field describes the entry at path; a link is reported as
+		// itself, since paths through it are refused and there is no target
+		// to report on.
+		meta, err := fs.LstatMeta(resolved)
 		if err != nil {
-			if os.IsNotExist(err) {
-				fsops.WriteError(w, http.StatusNotFound, "NOT_FOUND", "file or directory not found")
-				return
-			}
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+			writeFSError(w, r, err, "file or directory not found")
 			return
 		}
 
-		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"size":        info.Size(),
-			"isDirectory": info.IsDir(),
-			"modified":    info.ModTime().UTC().Format("2006-01-02T15:04:05.000Z"),
-			"created":     info.ModTime().UTC().Format("2006-01-02T15:04:05.000Z"),
-		})
+		isSymlink := meta.Mode&os.ModeSymlink != 0
+		result := map[string]interface{}{
+			"size":        meta.Size,
+			"isDirectory": meta.IsDir(),
+			"isSymlink":   isSymlink,
+			"modified":    formatTime(meta.Modified),
+			"mode":        meta.RawMode,
+			"permissions": fmt.Sprintf("%04o", uint32(meta.Mode.Perm())),
+		}
+		if meta.Inode != 0 {
+			// Inode numbers can exceed what a JavaScript number holds exactly.
+			result["inode"] = strconv.FormatUint(meta.Inode, 10)
+			result["nlink"] = meta.Nlink
+			result["accessed"] = formatTime(meta.Accessed)
+			result["changed"] = formatTime(meta.Changed)
+		}
+		// created stays the modification time where birth times are not
+		// recorded, which is what clients saw before.
+		result["birthtimeKnown"] = !meta.Born.IsZero()
+		if meta.Born.IsZero() {
+			result["created"] = formatTime(meta.Modified)
+		} else {
+			result["created"] = formatTime(meta.Born)
+		}
+		if meta.Mode.IsRegular() {
+			// Detection reads the file and may open it as a zip, so it is
+			// only done when asked for.
+			if r.URL.Query().Get("mime") == "true" {
+				if f, err := fs.Open(resolved); err == nil {
+					result["mime"] = contentType(fs, resolved, f, meta.Size)
+					f.Close()
+				}
+			}
+			if attr, err := fs.GetXattr(resolved, fsops.XattrSHA256); err == nil {
+				if digest, ok := fsops.ParseHashAttr(attr, meta.Modified); ok {
+					result["hash"] = "sha256:" + digest
+				}
+			}
+		}
+		if isSymlink {
+			if target, err := fs.Readlink(resolved); err == nil {
+				result["target"] = filepath.ToSlash(target)
+			}
+		}
+		fsops.WriteJSON(w, http.StatusOK, result)
 	}
 }
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatDescribesLinkItself(t *testing.T) {
+	d, serve := newTestDeps(t)
+	h := serve(Stat(d))
+
+	root, _ := d.Users.Root(testUserID)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte(strings.Repeat("x", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat?path=link", nil)
+	req.Header.Set("X-User-Id", testUserID)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var env struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	got := env.Data
+	if got["isSymlink"] != true || got["target"] != "a.txt" {
+		t.Fatalf("expected a link to a.txt, got %v", got)
+	}
+	if got["size"] != float64(len("a.txt")) || got["mode"].(float64) != 0o120777 {
+		t.Fatalf("expected the link's own size and mode, got %v", got)
+	}
+	if _, ok := got["mime"]; ok {
+		t.Fatalf("expected no content type for a link, got %v", got["mime"])
+	}
+	if inode, ok := got["inode"]; ok {
+		if _, isString := inode.(string); !isString {
+			t.Fatalf("expected inode as a string, got %T", inode)
+		}
+	}
+}
+
+func TestStatDetectsContentTypeOnRequest(t *testing.T) {
+	d, serve := newTestDeps(t)
+	h := serve(Stat(d))
+
+	root, _ := d.Users.Root(testUserID)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, want := range map[string]interface{}{"": nil, "&mime=true": "text/plain"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat?path=a.txt"+query, nil)
+		req.Header.Set("X-User-Id", testUserID)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var env struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+			t.Fatal(err)
+		}
+		if got := env.Data["mime"]; got != want {
+			t.Errorf("%q: mime = %v, want %v", query, got, want)
+		}
+	}
+}
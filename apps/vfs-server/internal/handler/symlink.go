@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/protean/vfs-server/internal/events"
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
+)
+
+type linkRequest struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// Symlink creates a symbolic link at path pointing to target. Both are
+// workspace paths; the link is stored relative to its own directory so it
+// also resolves for sandboxes that mount the workspace elsewhere.
+func Symlink(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
+
+		var req linkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fsops.WriteBodyError(w, err, "invalid request body")
+			return
+		}
+
+		resolved, target, ok := resolveLink(w, r, root, req)
+		if !ok {
+			return
+		}
+
+		linkTarget, err := filepath.Rel(filepath.Dir(resolved), target)
+		if err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		annotate(r, root, resolved, "")
+
+		unlock := d.lockExact(r, resolved)
+		defer unlock()
+
+		delta := quota.Usage{Files: 1}
+		if !d.charge(w, r, delta) {
+			return
+		}
+
+		if err := fs.MkdirAll(filepath.Dir(resolved), 0o755); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "")
+			return
+		}
+		if err := fs.Symlink(linkTarget, resolved); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "")
+			return
+		}
+
+		d.publish(r, root, events.TypeCreate, resolved, "", false)
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"created": true,
+			"target":  filepath.ToSlash(linkTarget),
+		})
+	}
+}
+
+// Link creates a hard link at path to the existing file target.
+func Link(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
+
+		var req linkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fsops.WriteBodyError(w, err, "invalid request body")
+			return
+		}
+
+		resolved, target, ok := resolveLink(w, r, root, req)
+		if !ok {
+			return
+		}
+
+		annotate(r, root, resolved, "")
+
+		unlock := d.lockExact(r, resolved, target)
+		defer unlock()
+
+		info, err := fs.Lstat(target)
+		if err != nil {
+			writeFSError(w, r, err, "link target not found")
+			return
+		}
+		if info.IsDir() {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "cannot hard link a directory")
+			return
+		}
+
+		// Scans count every link to a file, so a hard link is charged its
+		// full size.
+		delta := quota.Usage{Files: 1}
+		if info.Mode().IsRegular() {
+			delta.Bytes = info.Size()
+		}
+		if !d.charge(w, r, delta) {
+			return
+		}
+
+		if err := fs.MkdirAll(filepath.Dir(resolved), 0o755); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "")
+			return
+		}
+		if err := fs.Link(target, resolved); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "link target not found")
+			return
+		}
+
+		d.publish(r, root, events.TypeCreate, resolved, "", false)
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"created": true,
+		})
+	}
+}
+
+// ReadLink returns the stored target of a symbolic link and, when it resolves
+// inside the workspace, the workspace path it points to.
+func ReadLink(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
+
+		filePath := r.URL.Query().Get("path")
+		resolved, err := resolvePath(r, root, filePath)
+		if err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		info, err := fs.Lstat(resolved)
+		if err != nil {
+			writeFSError(w, r, err, "file or directory not found")
+			return
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			fsops.WriteError(w, http.StatusBadRequest, "NOT_SYMLINK", "path is not a symbolic link")
+			return
+		}
+
+		target, err := fs.Readlink(resolved)
+		if err != nil {
+			writeFSError(w, r, err, "file or directory not found")
+			return
+		}
+
+		result := map[string]interface{}{
+			"target": filepath.ToSlash(target),
+		}
+		if p, ok := linkWorkspacePath(root, resolved, target); ok {
+			result["resolvedPath"] = p
+		}
+		fsops.WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+// resolveLink resolves the path and target of a link request, writing an
+// error response when either is invalid.
+func resolveLink(w http.ResponseWriter, r *http.Request, root string, req linkRequest) (resolved, target string, ok bool) {
+	if req.Target == "" {
+		fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "missing target")
+		return "", "", false
+	}
+
+	resolved, err := resolvePath(r, root, req.Path)
+	if err != nil {
+		writePathError(w, err)
+		return "", "", false
+	}
+	if resolved == root {
+		fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "cannot replace the workspace root")
+		return "", "", false
+	}
+
+	target, err = resolvePath(r, root, req.Target)
+	if err != nil {
+		writePathError(w, err)
+		return "", "", false
+	}
+	if target == resolved {
+		fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "a link cannot point to itself")
+		return "", "", false
+	}
+	return resolved, target, true
+}
+
+// linkWorkspacePath returns the workspace path a symlink at resolved with the
+// stored target points to, if it stays inside the workspace.
+func linkWorkspacePath(root, resolved, target string) (string, bool) {
+	if filepath.IsAbs(target) {
+		return "", false
+	}
+	p, err := fsops.ResolveWithinRoot(root, workspacePath(root, filepath.Join(filepath.Dir(resolved), target)))
+	if err != nil {
+		return "", false
+	}
+	return workspacePath(root, p), true
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+)
+
+// Usage reports the current user's storage usage and limits. It covers the
+// whole workspace, so services limited to path prefixes may not call it.
+func Usage(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.GetUserID(r.Context())
+		if err := middleware.AuthorizePath(r.Context(), ""); err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		usage, reconciledAt, err := d.Quota.Usage(userID)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		limits := d.Quota.Limits()
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"bytes":         usage.Bytes,
+			"files":         usage.Files,
+			"limits":        limits,
+			"overSoftLimit": limits.OverSoft(usage),
+			"overHardLimit": limits.OverHard(usage),
+			"reconciledAt":  formatTime(reconciledAt),
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/protean/vfs-server/internal/config"
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/webhook"
+)
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	PathPrefix string   `json:"pathPrefix"`
+	Events     []string `json:"events"`
+	Secret     string   `json:"secret"`
+	Global     bool     `json:"global"`
+}
+
+// CreateWebhook registers a webhook for the current user, or for every user
+// when global is set. The signing secret is only returned here.
+func CreateWebhook(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.GetUserID(r.Context())
+
+		var req createWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fsops.WriteBodyError(w, err, "invalid request body")
+			return
+		}
+		if err := middleware.AuthorizePath(r.Context(), req.PathPrefix); err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		hook := webhook.Hook{
+			URL:        req.URL,
+			Secret:     req.Secret,
+			UserID:     userID,
+			Service:    middleware.GetServiceName(r.Context()),
+			PathPrefix: req.PathPrefix,
+			Events:     req.Events,
+		}
+		if req.Global {
+			if !middleware.HasScope(r.Context(), config.ScopeAdmin) {
+				fsops.WriteError(w, http.StatusForbidden, "FORBIDDEN", "global webhooks require the admin scope")
+				return
+			}
+			hook.UserID = ""
+		}
+
+		created, err := d.Webhooks.Add(hook)
+		if errors.Is(err, webhook.ErrInvalidHook) {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+
+		fsops.WriteJSON(w, http.StatusCreated, created)
+	}
+}
+
+// ListWebhooks returns the current user's hooks plus global hooks, without
+// their secrets. Hooks may watch any path, so services limited to path
+// prefixes can neither list nor remove them.
+func ListWebhooks(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.GetUserID(r.Context())
+		if err := middleware.AuthorizePath(r.Context(), ""); err != nil {
+			writePathError(w, err)
+			return
+		}
+
+		hooks := d.Webhooks.List(userID)
+		for i := range hooks {
+			hooks[i].Secret = ""
+		}
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"webhooks": hooks,
+		})
+	}
+}
+
+// DeleteWebhook removes a hook owned by the current user, or a global hook
+// when ?global=true.
+func DeleteWebhook(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner := middleware.GetUserID(r.Context())
+		if err := middleware.AuthorizePath(r.Context(), ""); err != nil {
+			writePathError(w, err)
+			return
+		}
+		if r.URL.Query().Get("global") == "true" {
+			if !middleware.HasScope(r.Context(), config.ScopeAdmin) {
+				fsops.WriteError(w, http.StatusForbidden, "FORBIDDEN", "global webhooks require the admin scope")
+				return
+			}
+			owner = ""
+		}
+
+		if err := d.Webhooks.Remove(chi.URLParam(r, "id"), owner); err != nil {
+			if errors.Is(err, webhook.ErrNotFound) {
+				fsops.WriteError(w, http.StatusNotFound, "NOT_FOUND", "webhook not found")
+				return
+			}
+			writeInternalError(w, r, err)
+			return
+		}
+
+		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"removed": true,
+		})
+	}
+}
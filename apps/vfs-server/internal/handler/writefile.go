@@ -1,54 +1,177 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 
+	"github.com/protean/vfs-server/internal/events"
 	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/journal"
 	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
 )
 
 type writeFileRequest struct {
 	Path    string `json:"path"`
 	Content string `json:"content"`
+	// CreateOnly, or Overwrite set to false, fails the write with
+	// ALREADY_EXISTS instead of replacing an existing file.
+	CreateOnly bool  `json:"createOnly"`
+	Overwrite  *bool `json:"overwrite"`
 }
 
-func WriteFile(workspaceBase string, locker *fsops.PathLocker) http.HandlerFunc {
+func WriteFile(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
 		var req writeFileRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
+			fsops.WriteBodyError(w, err, "invalid request body")
 			return
 		}
 
-		resolved, err := fsops.ResolveWithinRoot(root, req.Path)
+		noReplace, ok := replaceMode(w, req.CreateOnly, req.Overwrite)
+		if !ok {
+			return
+		}
+
+		resolved, err := resolvePath(r, root, req.Path)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
+			return
+		}
+
+		annotate(r, root, resolved, "")
+
+		data := []byte(req.Content)
+		if !checkUploadDigest(w, r, data) {
 			return
 		}
 
-		unlock := locker.LockExact(resolved)
+		unlock := d.lockExact(r, resolved)
 		defer unlock()
 
+		prev, statErr := fs.Stat(resolved)
+		existed := statErr == nil
+		if !checkWriteTarget(w, prev, existed, noReplace) {
+			return
+		}
+
+		delta := quota.Usage{Bytes: int64(len(data))}
+		if existed {
+			delta.Bytes -= prev.Size()
+		} else {
+			delta.Files = 1
+		}
+		if !d.charge(w, r, delta) {
+			return
+		}
+
 		// Auto-create parent directories
-		if err := os.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		if err := fs.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "")
 			return
 		}
 
-		data := []byte(req.Content)
-		if err := os.WriteFile(resolved, data, 0644); err != nil {
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		if err := writeTarget(fs, resolved, data, noReplace); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "")
 			return
 		}
 
+		digest := recordHash(fs, resolved, data)
+		recordContentType(r, fs, resolved, "")
+		journal.AddBytes(r.Context(), int64(len(data)))
+		d.Metrics.AddBytesWritten(len(data))
+		d.publish(r, root, writeEventType(existed), resolved, "", false)
+
 		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"bytesWritten": len(data),
+			"hash":         "sha256:" + digest,
 		})
 	}
 }
+
+// replaceMode reads the createOnly and overwrite options of writes and
+// renames, reporting whether an existing destination must be left alone.
+// Both default to replacing it.
+func replaceMode(w http.ResponseWriter, createOnly bool, overwrite *bool) (noReplace, ok bool) {
+	if createOnly && overwrite != nil && *overwrite {
+		fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "createOnly and overwrite are mutually exclusive")
+		return false, false
+	}
+	return createOnly || (overwrite != nil && !*overwrite), true
+}
+
+// checkWriteTarget rejects writes onto a directory, and onto any existing
+// file when noReplace is set, before quota is charged.
+func checkWriteTarget(w http.ResponseWriter, prev os.FileInfo, existed, noReplace bool) bool {
+	switch {
+	case existed && prev.IsDir():
+		fsops.WriteError(w, http.StatusConflict, "IS_DIRECTORY", "path is a directory")
+		return false
+	case existed && noReplace:
+		fsops.WriteError(w, http.StatusConflict, "ALREADY_EXISTS", "file already exists")
+		return false
+	}
+	return true
+}
+
+// writeTarget writes data to resolved. With noReplace the file is created
+// exclusively, so a file appearing since the check is not clobbered.
+func writeTarget(fs *fsops.Root, resolved string, data []byte, noReplace bool) error {
+	if noReplace {
+		return fs.CreateFile(resolved, data, 0644)
+	}
+	return fs.WriteFile(resolved, data, 0644)
+}
+
+// recordHash caches the SHA-256 of data, just written to resolved, for stat
+// to report, and returns it in hex. Filesystems without user xattrs go
+// without the cache.
+func recordHash(fs *fsops.Root, resolved string, data []byte) string {
+	sum := sha256.Sum256(data)
+	if meta, err := fs.StatMeta(resolved); err == nil {
+		fs.SetXattr(resolved, fsops.XattrSHA256, fsops.FormatHashAttr(sum[:], meta.Modified))
+	}
+	return hex.EncodeToString(sum[:])
+}
+
+// recordContentType stores ct as the explicit content type of resolved, or
+// clears a stored one when ct is empty since the content it described has
+// been replaced. It reports whether ct was stored.
+func recordContentType(r *http.Request, fs *fsops.Root, resolved, ct string) bool {
+	if ct == "" {
+		fs.RemoveXattr(resolved, fsops.XattrContentType)
+		return false
+	}
+	if err := fs.SetXattr(resolved, fsops.XattrContentType, ct); err != nil {
+		slog.WarnContext(r.Context(), "content type not stored", "requestId", middleware.GetRequestID(r.Context()), "error", err)
+		return false
+	}
+	return true
+}
+
+// contentType returns the type stored for resolved on upload, or else the
+// one detected from its content.
+func contentType(fs *fsops.Root, resolved string, content io.ReaderAt, size int64) string {
+	if ct, err := fs.GetXattr(resolved, fsops.XattrContentType); err == nil && ct != "" {
+		return ct
+	}
+	return fsops.DetectContentType(resolved, content, size)
+}
+
+func writeEventType(existed bool) string {
+	if existed {
+		return events.TypeModify
+	}
+	return events.TypeCreate
+}
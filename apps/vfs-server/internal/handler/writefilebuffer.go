@@ -1,23 +1,28 @@
 package handler
 
 import (
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/journal"
 	"github.com/protean/vfs-server/internal/middleware"
+	"github.com/protean/vfs-server/internal/quota"
 )
 
-func WriteFileBinary(workspaceBase string, locker *fsops.PathLocker) http.HandlerFunc {
+func WriteFileBinary(d *Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := middleware.GetUserID(r.Context())
-		root := filepath.Join(workspaceBase, userID)
+		root := middleware.GetUserRoot(r.Context())
+		fs := middleware.GetUserFS(r.Context())
 
-		// Parse multipart form: 32MB max
+		// Parse multipart form: up to 32MB in memory, the rest spills to
+		// temporary files. The total is capped by the route's body limit.
 		if err := r.ParseMultipartForm(32 << 20); err != nil {
-			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid multipart form")
+			fsops.WriteBodyError(w, err, "invalid multipart form")
 			return
 		}
 
@@ -27,6 +32,37 @@ func WriteFileBinary(workspaceBase string, locker *fsops.PathLocker) http.Handle
 			return
 		}
 
+		createOnly, err := formBool(r, "createOnly")
+		if err != nil {
+			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		var overwrite *bool
+		if r.FormValue("overwrite") != "" {
+			v, err := formBool(r, "overwrite")
+			if err != nil {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+				return
+			}
+			overwrite = &v
+		}
+		noReplace, ok := replaceMode(w, createOnly, overwrite)
+		if !ok {
+			return
+		}
+
+		// An explicit content type is stored with the file and served by
+		// read-binary in place of the detected one.
+		ct := r.FormValue("contentType")
+		if ct != "" {
+			mediaType, params, err := mime.ParseMediaType(ct)
+			if err != nil {
+				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid contentType")
+				return
+			}
+			ct = mime.FormatMediaType(mediaType, params)
+		}
+
 		file, _, err := r.FormFile("file")
 		if err != nil {
 			fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "missing file field")
@@ -34,33 +70,80 @@ func WriteFileBinary(workspaceBase string, locker *fsops.PathLocker) http.Handle
 		}
 		defer file.Close()
 
-		resolved, err := fsops.ResolveWithinRoot(root, filePath)
+		resolved, err := resolvePath(r, root, filePath)
 		if err != nil {
-			fsops.WriteError(w, http.StatusForbidden, "PATH_TRAVERSAL", err.Error())
+			writePathError(w, err)
 			return
 		}
 
+		annotate(r, root, resolved, "")
+
 		data, err := io.ReadAll(file)
 		if err != nil {
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+			writeInternalError(w, r, err)
+			return
+		}
+		if !checkUploadDigest(w, r, data) {
 			return
 		}
 
-		unlock := locker.LockExact(resolved)
+		unlock := d.lockExact(r, resolved)
 		defer unlock()
 
-		if err := os.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		prev, statErr := fs.Stat(resolved)
+		existed := statErr == nil
+		if !checkWriteTarget(w, prev, existed, noReplace) {
+			return
+		}
+
+		delta := quota.Usage{Bytes: int64(len(data))}
+		if existed {
+			delta.Bytes -= prev.Size()
+		} else {
+			delta.Files = 1
+		}
+		if !d.charge(w, r, delta) {
 			return
 		}
 
-		if err := os.WriteFile(resolved, data, 0644); err != nil {
-			fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		if err := fs.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "")
 			return
 		}
 
-		fsops.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		if err := writeTarget(fs, resolved, data, noReplace); err != nil {
+			d.refund(r, delta)
+			writeFSError(w, r, err, "")
+			return
+		}
+
+		digest := recordHash(fs, resolved, data)
+		stored := recordContentType(r, fs, resolved, ct)
+		journal.AddBytes(r.Context(), int64(len(data)))
+		d.Metrics.AddBytesWritten(len(data))
+		d.publish(r, root, writeEventType(existed), resolved, "", false)
+
+		result := map[string]interface{}{
 			"bytesWritten": len(data),
-		})
+			"hash":         "sha256:" + digest,
+		}
+		if stored {
+			result["contentType"] = ct
+		}
+		fsops.WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+// formBool parses an optional boolean form field.
+func formBool(r *http.Request, name string) (bool, error) {
+	raw := r.FormValue(name)
+	if raw == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean", name)
 	}
+	return v, nil
 }
@@ -0,0 +1,389 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	currentName   = "audit.jsonl"
+	rotatedPrefix = "audit-"
+	rotatedSuffix = ".jsonl"
+)
+
+// Entry is one mutating operation recorded in the journal.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	UserID  string    `json:"userId"`
+	Op      string    `json:"op"`
+	Path    string    `json:"path,omitempty"`
+	NewPath string    `json:"newPath,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Status  int       `json:"status"`
+	// Result is "ok" for successful operations, otherwise the error code.
+	Result string `json:"result"`
+}
+
+// Query filters journal entries.
+type Query struct {
+	UserID string
+	// Path matches entries whose path or newPath is the prefix or below it.
+	Path  string
+	Since time.Time
+	// Limit keeps only the most recent matching entries; zero means no limit.
+	Limit int
+}
+
+// Journal is an append-only JSONL audit log with size-based rotation.
+type Journal struct {
+	mu           sync.Mutex
+	dir          string
+	maxBytes     int64
+	maxFiles     int
+	syncInterval time.Duration
+
+	file  *os.File
+	size  int64
+	dirty bool
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Open opens (or creates) the journal in dir. The current file is rotated once
+// it exceeds maxBytes and at most maxFiles rotated files are kept. With a
+// zero syncInterval every Append is synced to disk before it returns;
+// otherwise appends are synced together at most syncInterval apart.
+func Open(dir string, maxBytes int64, maxFiles int, syncInterval time.Duration) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	j := &Journal{dir: dir, maxBytes: maxBytes, maxFiles: maxFiles, syncInterval: syncInterval}
+	if err := j.openCurrent(); err != nil {
+		return nil, err
+	}
+	if syncInterval > 0 {
+		j.stop = make(chan struct{})
+		j.done = make(chan struct{})
+		go j.syncLoop()
+	}
+	return j, nil
+}
+
+// syncLoop syncs batched appends every syncInterval until Close.
+func (j *Journal) syncLoop() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.mu.Lock()
+			if err := j.syncLocked(); err != nil {
+				log.Printf("journal: sync: %v", err)
+			}
+			j.mu.Unlock()
+		}
+	}
+}
+
+// syncLocked syncs the current file if anything was written since the last
+// sync.
+func (j *Journal) syncLocked() error {
+	if j.file == nil || !j.dirty {
+		return nil
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.dirty = false
+	return nil
+}
+
+func (j *Journal) openCurrent() error {
+	f, err := os.OpenFile(filepath.Join(j.dir, currentName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("journal: %w", err)
+	}
+	j.file = f
+	j.size = info.Size()
+	return j.terminateTornLine()
+}
+
+// terminateTornLine makes sure a partial line left by a crash does not swallow
+// the next entry.
+func (j *Journal) terminateTornLine() error {
+	if j.size == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	r, err := os.Open(j.file.Name())
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	defer r.Close()
+	if _, err := r.ReadAt(last, j.size-1); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	n, err := j.file.Write([]byte{'\n'})
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	return nil
+}
+
+// Append writes e to the journal and, unless syncs are batched, syncs it to
+// disk.
+func (j *Journal) Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return fmt.Errorf("journal: closed")
+	}
+	if j.maxBytes > 0 && j.size > 0 && j.size+int64(len(line)) > j.maxBytes {
+		if err := j.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	j.dirty = true
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	if j.syncInterval > 0 {
+		return nil
+	}
+	return j.syncLocked()
+}
+
+func (j *Journal) rotateLocked() error {
+	if err := j.syncLocked(); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	j.file = nil
+
+	name := rotatedPrefix + time.Now().UTC().Format("20060102T150405.000000000Z") + rotatedSuffix
+	if err := os.Rename(filepath.Join(j.dir, currentName), filepath.Join(j.dir, name)); err != nil {
+		return fmt.Errorf("journal: rotate: %w", err)
+	}
+	if err := j.openCurrent(); err != nil {
+		return err
+	}
+
+	rotated, err := j.rotatedFiles()
+	if err != nil {
+		return err
+	}
+	for j.maxFiles > 0 && len(rotated) > j.maxFiles {
+		os.Remove(filepath.Join(j.dir, rotated[0]))
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// rotatedFiles lists rotated journal files, oldest first.
+func (j *Journal) rotatedFiles() ([]string, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, rotatedPrefix) && strings.HasSuffix(name, rotatedSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Find returns the entries matching q in chronological order. The lock is
+// held only to open the files, so appends carry on while they are scanned;
+// entries appended after that are not returned. Files are read newest first,
+// stopping once Limit entries are found or the files predate Since.
+func (j *Journal) Find(q Query) ([]Entry, error) {
+	files, err := j.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, s := range files {
+			s.f.Close()
+		}
+	}()
+
+	var found [][]Entry
+	var total int
+	for i := len(files) - 1; i >= 0; i-- {
+		s := files[i]
+		if s.rotated && !q.Since.IsZero() && s.modTime.Before(q.Since) {
+			// Rotated files are never written again, so one last modified
+			// before Since cannot contain newer entries, nor can any older
+			// file.
+			break
+		}
+		matched, err := scan(io.NewSectionReader(s.f, 0, s.size), q)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, matched)
+		total += len(matched)
+		if q.Limit > 0 && total >= q.Limit {
+			break
+		}
+	}
+
+	result := make([]Entry, 0, total)
+	for i := len(found) - 1; i >= 0; i-- {
+		result = append(result, found[i]...)
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result, nil
+}
+
+// snapshotFile is a journal file opened for Find, with the size it had then.
+// The open descriptor keeps reading the same file across a rotation.
+type snapshotFile struct {
+	f       *os.File
+	size    int64
+	modTime time.Time
+	rotated bool
+}
+
+// snapshot opens every journal file, oldest first.
+func (j *Journal) snapshot() ([]snapshotFile, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	rotated, err := j.rotatedFiles()
+	if err != nil {
+		return nil, err
+	}
+	var files []snapshotFile
+	for _, name := range append(rotated, currentName) {
+		f, err := os.Open(filepath.Join(j.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		var info os.FileInfo
+		if err == nil {
+			info, err = f.Stat()
+			if err != nil {
+				f.Close()
+			}
+		}
+		if err != nil {
+			for _, s := range files {
+				s.f.Close()
+			}
+			return nil, fmt.Errorf("journal: %w", err)
+		}
+		files = append(files, snapshotFile{f: f, size: info.Size(), modTime: info.ModTime(), rotated: name != currentName})
+	}
+	return files, nil
+}
+
+func scan(r io.Reader, q Query) ([]Entry, error) {
+	var result []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A torn final line from a crash is skipped rather than failing
+			// the whole query.
+			continue
+		}
+		if q.matches(e) {
+			result = append(result, e)
+		}
+		if q.Limit > 0 && len(result) > q.Limit {
+			result = result[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	return result, nil
+}
+
+func (q Query) matches(e Entry) bool {
+	if q.UserID != "" && e.UserID != q.UserID {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	return underPrefix(e.Path, q.Path) || underPrefix(e.NewPath, q.Path)
+}
+
+func underPrefix(path, prefix string) bool {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" || prefix == "." {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Close flushes and closes the current journal file.
+func (j *Journal) Close() error {
+	if j.stop != nil {
+		j.stopOnce.Do(func() {
+			close(j.stop)
+			<-j.done
+		})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Sync()
+	if cerr := j.file.Close(); err == nil {
+		err = cerr
+	}
+	j.file = nil
+	return err
+}
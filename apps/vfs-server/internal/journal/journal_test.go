@@ -0,0 +1,242 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalAppendAndFind(t *testing.T) {
+	j, err := Open(t.TempDir(), 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: base, Service: "agent", UserID: "user-aaaaaaaa", Op: "write", Path: "docs/a.txt", Status: 200, Result: "ok"},
+		{Time: base.Add(time.Minute), Service: "webapp", UserID: "user-bbbbbbbb", Op: "remove", Path: "docs/a.txt", Status: 200, Result: "ok"},
+		{Time: base.Add(2 * time.Minute), Service: "agent", UserID: "user-aaaaaaaa", Op: "rename", Path: "notes.txt", NewPath: "docs/notes.txt", Status: 200, Result: "ok"},
+		{Time: base.Add(3 * time.Minute), Service: "agent", UserID: "user-aaaaaaaa", Op: "remove", Path: "docs", Status: 404, Result: "NOT_FOUND"},
+	}
+	for _, e := range entries {
+		if err := j.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := j.Find(Query{UserID: "user-aaaaaaaa", Path: "docs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries under docs for user-aaaaaaaa, got %d: %+v", len(got), got)
+	}
+
+	got, err = j.Find(Query{UserID: "user-aaaaaaaa", Since: base.Add(90 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Op != "rename" {
+		t.Fatalf("expected 2 entries since 12:01:30, got %+v", got)
+	}
+
+	got, err = j.Find(Query{UserID: "user-aaaaaaaa", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Result != "NOT_FOUND" {
+		t.Fatalf("expected only the most recent entry, got %+v", got)
+	}
+}
+
+func TestJournalRotatesAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir, 200, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := j.Append(Entry{UserID: "user-aaaaaaaa", Op: "write", Path: "a.txt", Status: 200, Result: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := 0
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), rotatedPrefix) {
+			rotated++
+		}
+	}
+	if rotated != 2 {
+		t.Fatalf("expected 2 rotated files to be kept, got %d", rotated)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, currentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 200 {
+		t.Fatalf("expected current file to stay under the rotation size, got %d bytes", info.Size())
+	}
+
+	got, err := j.Find(Query{UserID: "user-aaaaaaaa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || len(got) >= 20 {
+		t.Fatalf("expected pruned history to keep some but not all entries, got %d", len(got))
+	}
+}
+
+func TestJournalFindNewestFirstStopsAtLimit(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir, 200, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := j.Append(Entry{UserID: "user-aaaaaaaa", Op: "write", Path: fmt.Sprintf("f%02d", i), Status: 200, Result: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replace the oldest rotated file with something unreadable: a query
+	// satisfied by newer files must not reach it.
+	rotated, err := j.rotatedFiles()
+	if err != nil || len(rotated) < 2 {
+		t.Fatalf("expected several rotated files, got %v, %v", rotated, err)
+	}
+	oldest := filepath.Join(dir, rotated[0])
+	if err := os.Remove(oldest); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(oldest, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := j.Find(Query{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Path != "f17" || got[2].Path != "f19" {
+		t.Fatalf("expected the last 3 entries in order, got %+v", got)
+	}
+	if _, err := j.Find(Query{}); err == nil {
+		t.Fatal("expected an unlimited query to read the oldest file")
+	}
+}
+
+func TestJournalBatchedSync(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir, 0, 0, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := j.Append(Entry{UserID: "user-aaaaaaaa", Op: "write", Path: "a.txt", Status: 200, Result: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	j, err = Open(dir, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	got, err := j.Find(Query{})
+	if err != nil || len(got) != 5 {
+		t.Fatalf("expected 5 entries after reopening, got %d, %v", len(got), err)
+	}
+}
+
+func TestJournalSkipsTornLines(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(Entry{UserID: "user-aaaaaaaa", Op: "write", Status: 200, Result: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, currentName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2026-01-0`)
+	f.Close()
+
+	j, err = Open(dir, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if err := j.Append(Entry{UserID: "user-aaaaaaaa", Op: "mkdir", Status: 200, Result: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := j.Find(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].Op != "mkdir" {
+		t.Fatalf("expected both intact entries around the torn line, got %+v", got)
+	}
+}
+
+func TestJournalFindWhileAppending(t *testing.T) {
+	j, err := Open(t.TempDir(), 2000, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := j.Append(Entry{UserID: "user-aaaaaaaa", Op: "write", Path: "a.txt", Status: 200, Result: "ok"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for {
+		got, err := j.Find(Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range got {
+			if e.Op != "write" || (i > 0 && e.Time.Before(got[i-1].Time)) {
+				t.Fatalf("entry %d out of order or torn: %+v", i, e)
+			}
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package journal
+
+import (
+	"context"
+	"sync"
+)
+
+type recordKey struct{}
+
+// Record collects the details of an operation as the handler learns them.
+type Record struct {
+	mu      sync.Mutex
+	path    string
+	newPath string
+	bytes   int64
+}
+
+// NewContext returns a context carrying an empty Record.
+func NewContext(ctx context.Context) (context.Context, *Record) {
+	rec := &Record{}
+	return context.WithValue(ctx, recordKey{}, rec), rec
+}
+
+// Annotate sets the workspace paths the current operation touches. It is a
+// no-op when the request is not being journaled.
+func Annotate(ctx context.Context, path, newPath string) {
+	rec, ok := ctx.Value(recordKey{}).(*Record)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	rec.path = path
+	rec.newPath = newPath
+	rec.mu.Unlock()
+}
+
+// AddBytes adds n to the number of bytes the current operation wrote.
+func AddBytes(ctx context.Context, n int64) {
+	rec, ok := ctx.Value(recordKey{}).(*Record)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	rec.bytes += n
+	rec.mu.Unlock()
+}
+
+// Fill copies the recorded details into e.
+func (r *Record) Fill(e *Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.Path = r.path
+	e.NewPath = r.newPath
+	e.Bytes = r.bytes
+}
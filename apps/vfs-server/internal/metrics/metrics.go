@@ -0,0 +1,192 @@
+// Package metrics exposes server metrics in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/quota"
+)
+
+// Metrics holds the server's collectors in a private registry. A nil
+// *Metrics is valid and records nothing, so tests can build handlers without
+// one.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests     *prometheus.HistogramVec
+	bytesRead    prometheus.Counter
+	bytesWritten prometheus.Counter
+	lockWait     *prometheus.HistogramVec
+}
+
+// New creates the collectors along with the standard Go runtime and process
+// collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "vfs_http_request_duration_seconds",
+			Help:    "Time to serve HTTP requests, by route pattern, method and status.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"route", "method", "status"}),
+		bytesRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "vfs_file_bytes_read_total",
+			Help: "File content bytes returned to clients.",
+		}),
+		bytesWritten: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "vfs_file_bytes_written_total",
+			Help: "File content bytes written for clients.",
+		}),
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "vfs_lock_wait_seconds",
+			Help:    "Time spent waiting to acquire path locks, by lock kind.",
+			Buckets: []float64{.0001, .001, .005, .01, .05, .1, .5, 1, 5, 30},
+		}, []string{"kind"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.bytesRead,
+		m.bytesWritten,
+		m.lockWait,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served request. route is the matched route
+// pattern, not the raw path, to keep label cardinality bounded.
+func (m *Metrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+// AddBytesRead counts file content returned to a client.
+func (m *Metrics) AddBytesRead(n int) {
+	if m == nil {
+		return
+	}
+	m.bytesRead.Add(float64(n))
+}
+
+// AddBytesWritten counts file content written for a client.
+func (m *Metrics) AddBytesWritten(n int) {
+	if m == nil {
+		return
+	}
+	m.bytesWritten.Add(float64(n))
+}
+
+// WatchLocker records pl's lock waits and exposes its held locks and waiters
+// as gauges.
+func (m *Metrics) WatchLocker(pl *fsops.PathLocker) {
+	pl.ObserveWaits(func(kind string, waited time.Duration) {
+		m.lockWait.WithLabelValues(kind).Observe(waited.Seconds())
+	})
+
+	gauge := func(name, help string, value func(fsops.LockStats) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(pl.Stats()))
+		})
+	}
+	m.registry.MustRegister(
+		gauge("vfs_locks_exact_active", "Paths currently held by exact locks.", func(s fsops.LockStats) int { return s.Exact }),
+		gauge("vfs_locks_subtree_active", "Paths currently held by subtree locks.", func(s fsops.LockStats) int { return s.Subtree }),
+		gauge("vfs_locks_subtree_read_active", "Paths currently held by shared subtree read locks.", func(s fsops.LockStats) int { return s.SubtreeRead }),
+		gauge("vfs_lock_waiters", "Requests blocked waiting for a path lock.", func(s fsops.LockStats) int { return s.Waiters }),
+	)
+}
+
+// WatchQuota exposes how storage is spread across the workspaces t tracks.
+// Usage is bucketed rather than labelled by user, which would expose user
+// IDs and grow a series per workspace. A positive perUserTop also exports
+// per-user gauges for that many users, largest first.
+func (m *Metrics) WatchQuota(t *quota.Tracker, perUserTop int) {
+	m.registry.MustRegister(&usageCollector{tracker: t, perUserTop: perUserTop})
+}
+
+var (
+	workspaceBytesDesc = prometheus.NewDesc("vfs_workspace_storage_bytes", "Bytes stored per workspace, across the workspaces tracked since startup.", nil, nil)
+	workspaceFilesDesc = prometheus.NewDesc("vfs_workspace_storage_files", "Entries per workspace, across the workspaces tracked since startup.", nil, nil)
+
+	userBytesDesc = prometheus.NewDesc("vfs_user_storage_bytes", "Bytes stored in a user's workspace, for the users storing the most.", []string{"user_id"}, nil)
+	userFilesDesc = prometheus.NewDesc("vfs_user_storage_files", "Entries in a user's workspace, for the users storing the most.", []string{"user_id"}, nil)
+
+	workspaceBytesBuckets = []float64{1 << 20, 10 << 20, 100 << 20, 1 << 30, 10 << 30}
+	workspaceFilesBuckets = []float64{10, 100, 1000, 10000, 100000}
+)
+
+type usageCollector struct {
+	tracker    *quota.Tracker
+	perUserTop int
+}
+
+func (c *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- workspaceBytesDesc
+	ch <- workspaceFilesDesc
+	if c.perUserTop > 0 {
+		ch <- userBytesDesc
+		ch <- userFilesDesc
+	}
+}
+
+func (c *usageCollector) Collect(ch chan<- prometheus.Metric) {
+	tracked := c.tracker.Tracked()
+	bytes := make([]float64, 0, len(tracked))
+	files := make([]float64, 0, len(tracked))
+	for _, usage := range tracked {
+		bytes = append(bytes, float64(usage.Bytes))
+		files = append(files, float64(usage.Files))
+	}
+	ch <- constHistogram(workspaceBytesDesc, workspaceBytesBuckets, bytes)
+	ch <- constHistogram(workspaceFilesDesc, workspaceFilesBuckets, files)
+
+	if c.perUserTop <= 0 {
+		return
+	}
+	users := make([]string, 0, len(tracked))
+	for userID := range tracked {
+		users = append(users, userID)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if tracked[users[i]].Bytes != tracked[users[j]].Bytes {
+			return tracked[users[i]].Bytes > tracked[users[j]].Bytes
+		}
+		return users[i] < users[j]
+	})
+	for _, userID := range users[:min(len(users), c.perUserTop)] {
+		usage := tracked[userID]
+		ch <- prometheus.MustNewConstMetric(userBytesDesc, prometheus.GaugeValue, float64(usage.Bytes), userID)
+		ch <- prometheus.MustNewConstMetric(userFilesDesc, prometheus.GaugeValue, float64(usage.Files), userID)
+	}
+}
+
+// constHistogram builds a histogram of values with cumulative bucket counts.
+func constHistogram(desc *prometheus.Desc, bounds, values []float64) prometheus.Metric {
+	var sum float64
+	buckets := make(map[float64]uint64, len(bounds))
+	for _, v := range values {
+		sum += v
+		for _, b := range bounds {
+			if v <= b {
+				buckets[b]++
+			}
+		}
+	}
+	return prometheus.MustNewConstHistogram(desc, uint64(len(values)), sum, buckets)
+}
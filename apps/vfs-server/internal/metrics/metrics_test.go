@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/quota"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricsExposition(t *testing.T) {
+	m := New()
+
+	locker := fsops.NewPathLocker()
+	m.WatchLocker(locker)
+	unlock := locker.LockSubtree("/x/dir")
+	defer unlock()
+
+	dirs, err := fsops.NewUserDirs(t.TempDir(), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := quota.NewTracker(dirs, quota.Limits{})
+	if _, err := tracker.Charge("user-12345678", quota.Usage{Bytes: 42, Files: 2}); err != nil {
+		t.Fatal(err)
+	}
+	m.WatchQuota(tracker, 0)
+
+	m.ObserveRequest("/api/v1/files/read", "GET", 200, 3*time.Millisecond)
+	m.AddBytesRead(10)
+	m.AddBytesWritten(20)
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`vfs_http_request_duration_seconds_count{method="GET",route="/api/v1/files/read",status="200"} 1`,
+		`vfs_file_bytes_read_total 10`,
+		`vfs_file_bytes_written_total 20`,
+		`vfs_lock_wait_seconds_count{kind="subtree"} 1`,
+		`vfs_locks_subtree_active 1`,
+		`vfs_locks_exact_active 0`,
+		`vfs_lock_waiters 0`,
+		`vfs_workspace_storage_bytes_bucket{le="1.048576e+06"} 1`,
+		`vfs_workspace_storage_bytes_sum 42`,
+		`vfs_workspace_storage_files_bucket{le="10"} 1`,
+		`vfs_workspace_storage_files_count 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in exposition", want)
+		}
+	}
+	if strings.Contains(out, "user-12345678") {
+		t.Error("exposition labels series with a user ID")
+	}
+}
+
+func TestPerUserStorageGauges(t *testing.T) {
+	m := New()
+	dirs, err := fsops.NewUserDirs(t.TempDir(), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := quota.NewTracker(dirs, quota.Limits{})
+	for userID, bytes := range map[string]int64{"user-small": 1, "user-large": 300, "user-middle": 20} {
+		if _, err := tracker.Charge(userID, quota.Usage{Bytes: bytes, Files: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.WatchQuota(tracker, 2)
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`vfs_user_storage_bytes{user_id="user-large"} 300`,
+		`vfs_user_storage_bytes{user_id="user-middle"} 20`,
+		`vfs_user_storage_files{user_id="user-large"} 1`,
+		`vfs_workspace_storage_bytes_count 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in exposition", want)
+		}
+	}
+	if strings.Contains(out, "user-small") {
+		t.Error("expected only the top two users to be exported")
+	}
+}
+
+func TestNilMetricsRecordsNothing(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest("/", "GET", 200, time.Millisecond)
+	m.AddBytesRead(1)
+	m.AddBytesWritten(1)
+}
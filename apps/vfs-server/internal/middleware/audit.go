@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/journal"
+)
+
+// Audit records the outcome of the wrapped mutating operation in j.
+func Audit(j *journal.Journal, op string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if j == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, rec := journal.NewContext(r.Context())
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			entry := journal.Entry{
+				Service: GetServiceName(ctx),
+				UserID:  GetUserID(ctx),
+				Op:      op,
+				Status:  sw.status(),
+				Result:  "ok",
+			}
+			rec.Fill(&entry)
+			if entry.Status >= 400 {
+				entry.Result = sw.errorCode()
+			}
+
+			if err := j.Append(entry); err != nil {
+				log.Printf("audit: %v", err)
+			}
+		})
+	}
+}
+
+// statusWriter captures the response status and, for errors, the start of the
+// envelope so its error code can be recorded.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+const maxCapturedErrorBody = 4 << 10
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.code >= 400 && w.body.Len() < maxCapturedErrorBody {
+		w.body.Write(p[:min(len(p), maxCapturedErrorBody-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+func (w *statusWriter) errorCode() string {
+	var env fsops.Envelope
+	if err := json.Unmarshal(w.body.Bytes(), &env); err == nil && env.Error != nil && env.Error.Code != "" {
+		return env.Error.Code
+	}
+	return http.StatusText(w.status())
+}
@@ -1,14 +1,21 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/protean/vfs-server/internal/fsops"
 )
 
+const serviceNameKey contextKey = "serviceName"
+
 // ServiceAuth validates the Bearer token in the Authorization header against
-// the configured service tokens map.
+// the configured service tokens map and injects the service name into the
+// request context.
 func ServiceAuth(tokens map[string]string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -19,12 +26,23 @@ func ServiceAuth(tokens map[string]string) func(http.Handler) http.Handler {
 			}
 
 			token := strings.TrimPrefix(auth, "Bearer ")
-			if _, ok := tokens[token]; !ok {
+			serviceName, ok := tokens[token]
+			if !ok {
 				fsops.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid service token")
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			logService(r, serviceName)
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("vfs.service", serviceName))
+			ctx := context.WithValue(r.Context(), serviceNameKey, serviceName)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// GetServiceName retrieves the authenticated service name from the request
+// context.
+func GetServiceName(ctx context.Context) string {
+	v, _ := ctx.Value(serviceNameKey).(string)
+	return v
+}
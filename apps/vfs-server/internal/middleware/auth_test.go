@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServiceAuthInjectsServiceName(t *testing.T) {
+	tokens := map[string]string{"tok-agent": "agent", "tok-webapp": "webapp"}
+
+	var got string
+	h := ServiceAuth(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetServiceName(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat", nil)
+	req.Header.Set("Authorization", "Bearer tok-agent")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got != "agent" {
+		t.Fatalf("expected service name %q in context, got %q", "agent", got)
+	}
+}
+
+func TestServiceAuthRejectsUnknownToken(t *testing.T) {
+	h := ServiceAuth(map[string]string{"tok-agent": "agent"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be reached")
+	}))
+
+	for _, auth := range []string{"", "Basic abc", "Bearer nope"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", auth, rec.Code)
+		}
+	}
+}
+
+func TestGetServiceNameWithoutAuth(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := GetServiceName(req.Context()); got != "" {
+		t.Fatalf("expected empty service name, got %q", got)
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/protean/vfs-server/internal/config"
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+const policyKey contextKey = "policy"
+
+// ErrPathForbidden is returned by AuthorizePath for a path outside the
+// service's allowed prefixes.
+var ErrPathForbidden = errors.New("path not allowed")
+
+// Authorize rejects requests whose service lacks any of scopes with 403
+// FORBIDDEN, and records the service's policy for AuthorizePath. It must run
+// after ServiceAuth. Paths are checked by the handlers, which are the only
+// ones that know which fields of a request name them.
+func Authorize(policies map[string]config.Policy, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			service := GetServiceName(r.Context())
+			policy, ok := policies[service]
+			if !ok {
+				policy = config.DefaultPolicy()
+			}
+
+			for _, scope := range scopes {
+				if !policy.Has(scope) {
+					fsops.WriteError(w, http.StatusForbidden, "FORBIDDEN", fmt.Sprintf("service %q lacks the %q scope", service, scope))
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), policyKey, policy)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// HasScope reports whether the authorized service holds scope.
+func HasScope(ctx context.Context, scope string) bool {
+	policy, ok := ctx.Value(policyKey).(config.Policy)
+	return ok && policy.Has(scope)
+}
+
+// AuthorizePath returns an error wrapping ErrPathForbidden if the authorized
+// service may not access the workspace path p; an empty p is the workspace
+// root. A request Authorize has not seen is held to the default policy.
+func AuthorizePath(ctx context.Context, p string) error {
+	policy, ok := ctx.Value(policyKey).(config.Policy)
+	if !ok {
+		policy = config.DefaultPolicy()
+	}
+	if policy.AllowsPath(p) {
+		return nil
+	}
+	return fmt.Errorf("%w: service %q may not access %q", ErrPathForbidden, GetServiceName(ctx), config.CleanWorkspacePath(p))
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/protean/vfs-server/internal/config"
+)
+
+var testPolicies = map[string]config.Policy{
+	"memory": {
+		Scopes:       map[string]bool{config.ScopeRead: true, config.ScopeWrite: true},
+		PathPrefixes: []string{".threads"},
+	},
+}
+
+func serviceRequest(method, target, service string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	return req.WithContext(context.WithValue(req.Context(), serviceNameKey, service))
+}
+
+func TestAuthorizeEnforcesScopes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		service string
+		scopes  []string
+		want    int
+	}{
+		{"default policy allows delete", "agent", []string{config.ScopeDelete}, http.StatusOK},
+		{"default policy lacks admin", "agent", []string{config.ScopeAdmin}, http.StatusForbidden},
+		{"missing scope", "memory", []string{config.ScopeDelete}, http.StatusForbidden},
+		{"granted scopes", "memory", []string{config.ScopeRead, config.ScopeWrite}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Authorize(testPolicies, tt.scopes...)(ok).ServeHTTP(rec, serviceRequest(http.MethodGet, "/x", tt.service))
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if rec.Code == http.StatusForbidden {
+				var env struct {
+					Error struct{ Code string } `json:"error"`
+				}
+				json.Unmarshal(rec.Body.Bytes(), &env)
+				if env.Error.Code != "FORBIDDEN" {
+					t.Fatalf("expected FORBIDDEN error code, got %q", env.Error.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizePath(t *testing.T) {
+	contextFor := func(service string) context.Context {
+		var ctx context.Context
+		Authorize(testPolicies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx = r.Context()
+		})).ServeHTTP(httptest.NewRecorder(), serviceRequest(http.MethodGet, "/x", service))
+		return ctx
+	}
+	memory := contextFor("memory")
+
+	tests := []struct {
+		ctx     context.Context
+		path    string
+		allowed bool
+	}{
+		{memory, ".threads/t.json", true},
+		{memory, ".threads", true},
+		{memory, "docs/a.txt", false},
+		{memory, "", false},
+		{memory, ".threads/../x.txt", false},
+		{contextFor("agent"), "docs/a.txt", true},
+		{context.Background(), "", true},
+	}
+	for _, tt := range tests {
+		err := AuthorizePath(tt.ctx, tt.path)
+		if tt.allowed && err != nil {
+			t.Errorf("%q: unexpected error %v", tt.path, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrPathForbidden) {
+			t.Errorf("%q: expected ErrPathForbidden, got %v", tt.path, err)
+		}
+	}
+}
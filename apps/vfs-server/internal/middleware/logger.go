@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+const (
+	logEntryKey  contextKey = "logEntry"
+	requestIDKey contextKey = "requestId"
+)
+
+// maxRequestIDLength bounds client-supplied request IDs.
+const maxRequestIDLength = 128
+
+// Logger writes one structured line per request to logger. It assigns each
+// request an ID, reusing a well-formed X-Request-Id from the caller, and
+// returns it in the X-Request-Id response header, where WriteError also picks
+// it up for error envelopes.
+//
+// It must wrap the chi router: it provides the route context the router fills
+// in, so the line can name the matched route.
+func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := requestID(r.Header.Get(fsops.RequestIDHeader))
+			w.Header().Set(fsops.RequestIDHeader, id)
+
+			entry := &logEntry{}
+			rctx := chi.NewRouteContext()
+			ctx := context.WithValue(r.Context(), logEntryKey, entry)
+			ctx = context.WithValue(ctx, requestIDKey, id)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+			ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			attrs := []slog.Attr{
+				slog.String("requestId", id),
+				slog.String("method", r.Method),
+				slog.String("route", rctx.RoutePattern()),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Float64("durationMs", float64(time.Since(start).Microseconds())/1000),
+			}
+
+			entry.mu.Lock()
+			if entry.service != "" {
+				attrs = append(attrs, slog.String("service", entry.service))
+			}
+			if entry.userID != "" {
+				attrs = append(attrs, slog.String("userId", entry.userID))
+			}
+			if entry.err != nil {
+				attrs = append(attrs, slog.String("error", entry.err.Error()))
+			}
+			entry.mu.Unlock()
+
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+// GetRequestID returns the ID Logger assigned to the request.
+func GetRequestID(ctx context.Context) string {
+	v, _ := ctx.Value(requestIDKey).(string)
+	return v
+}
+
+// LogError attaches err to the request's log line. Handlers use it for
+// failures whose details are not shown to the client.
+func LogError(r *http.Request, err error) {
+	if e := getLogEntry(r); e != nil {
+		e.mu.Lock()
+		e.err = err
+		e.mu.Unlock()
+	}
+}
+
+// logEntry is filled in by ServiceAuth, UserContext and handlers, which run
+// deeper in the chain than the logger and cannot change its request context.
+type logEntry struct {
+	mu      sync.Mutex
+	service string
+	userID  string
+	err     error
+}
+
+func getLogEntry(r *http.Request) *logEntry {
+	e, _ := r.Context().Value(logEntryKey).(*logEntry)
+	return e
+}
+
+func logService(r *http.Request, service string) {
+	if e := getLogEntry(r); e != nil {
+		e.mu.Lock()
+		e.service = service
+		e.mu.Unlock()
+	}
+}
+
+func logUser(r *http.Request, userID string) {
+	if e := getLogEntry(r); e != nil {
+		e.mu.Lock()
+		e.userID = userID
+		e.mu.Unlock()
+	}
+}
+
+// requestID returns the caller's ID if it is short and made of safe
+// characters, or a new random one.
+func requestID(incoming string) string {
+	if incoming != "" && len(incoming) <= maxRequestIDLength && validRequestID(incoming) {
+		return incoming
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func validRequestID(s string) bool {
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
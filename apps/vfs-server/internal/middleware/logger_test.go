@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+func TestLoggerWritesJSONLineAndRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	r := chi.NewRouter()
+	r.Get("/api/v1/files/{kind}", func(w http.ResponseWriter, r *http.Request) {
+		logService(r, "webapp")
+		logUser(r, "user-1234")
+		LogError(r, errors.New("open /srv/workspaces/user-1234/a.txt: input/output error"))
+		fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", "internal error")
+	})
+	h := Logger(slog.New(slog.NewJSONHandler(&logs, nil)))(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/read?path=a.txt", nil)
+	req.Header.Set("X-Request-Id", "req-abc.123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-Id"); got != "req-abc.123" {
+		t.Fatalf("expected the caller's request id to be echoed, got %q", got)
+	}
+	var env fsops.Envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Error == nil || env.Error.RequestID != "req-abc.123" || env.Error.Message != "internal error" {
+		t.Fatalf("unexpected error envelope: %+v", env.Error)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("log line is not JSON: %v\n%s", err, logs.String())
+	}
+	want := map[string]interface{}{
+		"level":     "ERROR",
+		"msg":       "request",
+		"requestId": "req-abc.123",
+		"method":    "GET",
+		"route":     "/api/v1/files/{kind}",
+		"path":      "/api/v1/files/read",
+		"status":    float64(500),
+		"service":   "webapp",
+		"userId":    "user-1234",
+		"error":     "open /srv/workspaces/user-1234/a.txt: input/output error",
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s: got %v, want %v", k, line[k], v)
+		}
+	}
+	if _, ok := line["durationMs"]; !ok {
+		t.Error("missing durationMs")
+	}
+}
+
+func TestLoggerReplacesInvalidRequestID(t *testing.T) {
+	h := Logger(slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetRequestID(r.Context()) != w.Header().Get("X-Request-Id") {
+			t.Error("context and response header disagree on the request id")
+		}
+	}))
+
+	for _, incoming := range []string{"", "has spaces", "line\nbreak", string(bytes.Repeat([]byte("a"), 200))} {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set("X-Request-Id", incoming)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		got := rec.Header().Get("X-Request-Id")
+		if got == "" || got == incoming || len(got) != 32 {
+			t.Errorf("incoming %q: expected a generated id, got %q", incoming, got)
+		}
+	}
+}
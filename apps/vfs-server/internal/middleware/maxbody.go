@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+// MaxBody limits request bodies to limit bytes. Requests that declare a larger
+// Content-Length are rejected with 413 PAYLOAD_TOO_LARGE before anything is
+// read; chunked bodies fail with the same error once they cross the limit. A
+// limit of zero or less disables the check.
+func MaxBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				fsops.WriteError(w, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", fmt.Sprintf("request body exceeds %d bytes", limit))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+func TestMaxBody(t *testing.T) {
+	h := MaxBody(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			fsops.WriteBodyError(w, err, "invalid request body")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(body io.Reader, contentLength int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/files/write", body)
+		req.ContentLength = contentLength
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(strings.NewReader("12345678"), 8); rec.Code != http.StatusOK {
+		t.Fatalf("body at the limit: got %d", rec.Code)
+	}
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"declared": do(strings.NewReader("123456789"), 9),
+		"chunked":  do(strings.NewReader("123456789"), -1),
+	} {
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: expected 413, got %d", name, rec.Code)
+		}
+		var env fsops.Envelope
+		if err := json.NewDecoder(rec.Body).Decode(&env); err != nil || env.Error == nil || env.Error.Code != "PAYLOAD_TOO_LARGE" {
+			t.Fatalf("%s: unexpected body %+v (%v)", name, env, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/protean/vfs-server/internal/metrics"
+)
+
+func TestMetricsLabelsByRoutePattern(t *testing.T) {
+	m := metrics.New()
+	r := chi.NewRouter()
+	r.Use(Metrics(m))
+	r.Delete("/api/v1/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.With(RequireToken("secret")).Get("/metrics", m.Handler().ServeHTTP)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/v1/webhooks/abc123", nil))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the metrics token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+
+	want := `vfs_http_request_duration_seconds_count{method="DELETE",route="/api/v1/webhooks/{id}",status="404"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Fatalf("missing %q in:\n%s", want, body)
+	}
+}
+
+func TestRequireTokenOpenWithoutToken(t *testing.T) {
+	h := RequireToken("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 without a configured token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/ratelimit"
+)
+
+// RateLimit throttles requests per service and user with a token bucket.
+// GET and HEAD requests draw from the read budget and everything else from the
+// write budget. Throttled requests get 429 with a Retry-After header. If the
+// limiter's store fails the request is let through rather than failing the
+// API with it.
+func RateLimit(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			class := ratelimit.ClassWrite
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				class = ratelimit.ClassRead
+			}
+			key := GetServiceName(r.Context()) + "|" + GetUserID(r.Context())
+
+			ok, retryAfter, err := limiter.Allow(r.Context(), class, key)
+			if err != nil {
+				log.Printf("ratelimit: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ok {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+				fsops.WriteError(w, http.StatusTooManyRequests, "RATE_LIMITED", "too many "+class+" requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
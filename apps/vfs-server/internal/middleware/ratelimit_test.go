@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/protean/vfs-server/internal/ratelimit"
+)
+
+func TestRateLimitKeysByServiceAndUser(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.ClassRead:  {Rate: 0.5, Burst: 1},
+		ratelimit.ClassWrite: {Rate: 0.5, Burst: 1},
+	})
+	h := RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(method, service, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/files/stat", nil)
+		ctx := context.WithValue(req.Context(), serviceNameKey, service)
+		ctx = context.WithValue(ctx, userIDKey, user)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "webapp", "user-aaaaaaaa"); rec.Code != http.StatusOK {
+		t.Fatalf("first read: got %d", rec.Code)
+	}
+	rec := do(http.MethodGet, "webapp", "user-aaaaaaaa")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second read: expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("Retry-After = %q, want 2", got)
+	}
+
+	if rec := do(http.MethodPost, "webapp", "user-aaaaaaaa"); rec.Code != http.StatusOK {
+		t.Fatalf("writes have their own budget, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "webapp", "user-bbbbbbbb"); rec.Code != http.StatusOK {
+		t.Fatalf("other users have their own budget, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "agent", "user-aaaaaaaa"); rec.Code != http.StatusOK {
+		t.Fatalf("other services have their own budget, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/protean/vfs-server/internal/tracing"
+)
+
+// collector is a stand-in OTLP/HTTP endpoint that keeps the spans it receives.
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+}
+
+func TestTraceContinuesCallerTrace(t *testing.T) {
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Endpoint: srv.URL, SampleRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(Trace)
+	r.Get("/api/v1/files/stat", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "vfs.resolve")
+		span.End()
+	})
+
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat?path=a", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	byName := make(map[string]*tracepb.Span)
+	for _, s := range c.spans {
+		if got := hex.EncodeToString(s.TraceId); got != traceID {
+			t.Errorf("span %q has trace ID %s, want the caller's %s", s.Name, got, traceID)
+		}
+		byName[s.Name] = s
+	}
+
+	server, ok := byName["GET /api/v1/files/stat"]
+	if !ok {
+		t.Fatalf("no server span named after the route, got %v", byName)
+	}
+	if got := hex.EncodeToString(server.ParentSpanId); got != parentID {
+		t.Errorf("server span parent = %s, want %s", got, parentID)
+	}
+	if server.Kind != tracepb.Span_SPAN_KIND_SERVER {
+		t.Errorf("server span kind = %v", server.Kind)
+	}
+
+	child, ok := byName["vfs.resolve"]
+	if !ok {
+		t.Fatal("missing child span")
+	}
+	if string(child.ParentSpanId) != string(server.SpanId) {
+		t.Error("child span is not parented to the server span")
+	}
+}
@@ -4,33 +4,88 @@ import (
 	"context"
 	"net/http"
 	"os"
-	"path/filepath"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/usertoken"
 )
 
 type contextKey string
 
-const userIDKey contextKey = "userId"
+const (
+	userIDKey   contextKey = "userId"
+	userRootKey contextKey = "userRoot"
+	userFSKey   contextKey = "userFS"
+)
 
-// UserContext extracts and validates the X-User-Id header, ensures the user's
-// workspace directory exists, and injects the user ID into the request context.
-func UserContext(workspaceBase string) func(http.Handler) http.Handler {
+// UserContext determines the acting user, validates the ID against the
+// configured policy, ensures the user's workspace directory exists, and injects
+// the user ID, workspace root and an open fsops.Root for it into the request
+// context.
+//
+// A signed X-User-Token is verified against verifier and must have been issued
+// to the authenticated service; any X-User-Id sent alongside it must match. When
+// requireToken is false, a bare X-User-Id header is still trusted.
+func UserContext(dirs *fsops.UserDirs, verifier *usertoken.Verifier, requireToken bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			userID := r.Header.Get("X-User-Id")
-			if userID == "" || len(userID) < 8 {
+
+			if token := r.Header.Get("X-User-Token"); token != "" {
+				if !verifier.Enabled() {
+					fsops.WriteError(w, http.StatusUnauthorized, "INVALID_USER_TOKEN", "user tokens are not configured")
+					return
+				}
+				claims, err := verifier.Verify(token)
+				if err != nil {
+					fsops.WriteError(w, http.StatusUnauthorized, "INVALID_USER_TOKEN", err.Error())
+					return
+				}
+				if claims.Service != GetServiceName(r.Context()) {
+					fsops.WriteError(w, http.StatusUnauthorized, "INVALID_USER_TOKEN", "user token was issued to a different service")
+					return
+				}
+				if userID != "" && userID != claims.Subject {
+					fsops.WriteError(w, http.StatusUnauthorized, "INVALID_USER_TOKEN", "X-User-Id does not match user token")
+					return
+				}
+				userID = claims.Subject
+			} else if requireToken {
+				fsops.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "missing X-User-Token header")
+				return
+			}
+
+			if userID == "" {
 				fsops.WriteError(w, http.StatusBadRequest, "BAD_REQUEST", "missing X-User-Id header")
 				return
 			}
 
-			userRoot := filepath.Join(workspaceBase, userID)
+			userRoot, err := dirs.Root(userID)
+			if err != nil {
+				fsops.WriteError(w, http.StatusBadRequest, "INVALID_USER_ID", "user id is not allowed by the server's user id policy")
+				return
+			}
 			if err := os.MkdirAll(userRoot, 0755); err != nil {
+				LogError(r, err)
 				fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", "failed to prepare workspace")
 				return
 			}
 
+			fs, err := fsops.OpenRoot(userRoot)
+			if err != nil {
+				LogError(r, err)
+				fsops.WriteError(w, http.StatusInternalServerError, "INTERNAL", "failed to open workspace")
+				return
+			}
+			defer fs.Close()
+
+			logUser(r, userID)
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("vfs.user_id", userID))
 			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			ctx = context.WithValue(ctx, userRootKey, userRoot)
+			ctx = context.WithValue(ctx, userFSKey, fs.WithContext(ctx))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -41,3 +96,18 @@ func GetUserID(ctx context.Context) string {
 	v, _ := ctx.Value(userIDKey).(string)
 	return v
 }
+
+// GetUserRoot retrieves the user's workspace directory from the request
+// context.
+func GetUserRoot(ctx context.Context) string {
+	v, _ := ctx.Value(userRootKey).(string)
+	return v
+}
+
+// GetUserFS retrieves the open workspace root from the request context. File
+// operations go through it so they cannot follow symlinks out of the
+// workspace.
+func GetUserFS(ctx context.Context) *fsops.Root {
+	v, _ := ctx.Value(userFSKey).(*fsops.Root)
+	return v
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/protean/vfs-server/internal/fsops"
+	"github.com/protean/vfs-server/internal/usertoken"
+)
+
+func testUserDirs(t *testing.T) *fsops.UserDirs {
+	t.Helper()
+	dirs, err := fsops.NewUserDirs(t.TempDir(), fsops.UserIDPolicyCharset, "", fsops.UserDirLayoutFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dirs
+}
+
+func mintUserToken(t *testing.T, secret, service, userID string) string {
+	t.Helper()
+	now := time.Now()
+	token, err := usertoken.SignHS256(usertoken.Claims{
+		Subject:   userID,
+		Service:   service,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}, []byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestUserContextWithSignedToken(t *testing.T) {
+	verifier := usertoken.NewVerifier([][]byte{[]byte("secret")}, nil, time.Hour)
+
+	var got string
+	h := UserContext(testUserDirs(t), verifier, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUserID(r.Context())
+	}))
+
+	tests := []struct {
+		name    string
+		service string
+		token   string
+		userID  string
+		want    int
+	}{
+		{"valid token", "agent", mintUserToken(t, "secret", "agent", "user-aaaaaaaa"), "", http.StatusOK},
+		{"matching header", "agent", mintUserToken(t, "secret", "agent", "user-aaaaaaaa"), "user-aaaaaaaa", http.StatusOK},
+		{"mismatched header", "agent", mintUserToken(t, "secret", "agent", "user-aaaaaaaa"), "user-bbbbbbbb", http.StatusUnauthorized},
+		{"token for other service", "webapp", mintUserToken(t, "secret", "agent", "user-aaaaaaaa"), "", http.StatusUnauthorized},
+		{"bad signature", "agent", mintUserToken(t, "nope", "agent", "user-aaaaaaaa"), "", http.StatusUnauthorized},
+		{"header only when required", "agent", "", "user-aaaaaaaa", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat", nil)
+			req = req.WithContext(context.WithValue(req.Context(), serviceNameKey, tt.service))
+			if tt.token != "" {
+				req.Header.Set("X-User-Token", tt.token)
+			}
+			if tt.userID != "" {
+				req.Header.Set("X-User-Id", tt.userID)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if tt.want == http.StatusOK && got != "user-aaaaaaaa" {
+				t.Fatalf("expected user from token, got %q", got)
+			}
+		})
+	}
+}
+
+func TestUserContextLegacyHeaderWhenTokenOptional(t *testing.T) {
+	var got string
+	h := UserContext(testUserDirs(t), usertoken.NewVerifier(nil, nil, 0), false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUserID(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat", nil)
+	req.Header.Set("X-User-Id", "user-aaaaaaaa")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || got != "user-aaaaaaaa" {
+		t.Fatalf("expected legacy header to be accepted, got %d user=%q", rec.Code, got)
+	}
+}
+
+func TestUserContextRejectsUnsafeUserIDs(t *testing.T) {
+	dirs := testUserDirs(t)
+	h := UserContext(dirs, usertoken.NewVerifier(nil, nil, 0), false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("handler reached for unsafe user id, root=%q", GetUserRoot(r.Context()))
+	}))
+
+	for _, id := range []string{"../../etc/xxxxxxxx", "abc/defghijk", "..\\..\\xxxxxxxx", ".hidden-user"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat", nil)
+		req.Header.Set("X-User-Id", id)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "INVALID_USER_ID") {
+			t.Errorf("user id %q: expected 400 INVALID_USER_ID, got %d %s", id, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestUserContextLengthFollowsPolicy(t *testing.T) {
+	short, err := fsops.NewUserDirs(t.TempDir(), fsops.UserIDPolicyCharset, `^[a-z0-9]{2,}$`, fsops.UserDirLayoutFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dirs     *fsops.UserDirs
+		userID   string
+		want     int
+		wantCode string
+	}{
+		{"short id allowed by pattern", short, "ab", http.StatusOK, ""},
+		{"short id refused by default pattern", testUserDirs(t), "abc", http.StatusBadRequest, "INVALID_USER_ID"},
+		{"missing header", testUserDirs(t), "", http.StatusBadRequest, "BAD_REQUEST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := UserContext(tt.dirs, usertoken.NewVerifier(nil, nil, 0), false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/stat", nil)
+			if tt.userID != "" {
+				req.Header.Set("X-User-Id", tt.userID)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want || !strings.Contains(rec.Body.String(), tt.wantCode) {
+				t.Fatalf("expected %d %s, got %d %s", tt.want, tt.wantCode, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Package quota tracks per-user storage usage and enforces limits on it.
+package quota
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+// ErrExceeded is returned when a change would take a user past a hard limit.
+var ErrExceeded = errors.New("storage quota exceeded")
+
+// Limits are per-user storage limits. Zero means unlimited. Going past a soft
+// limit is allowed but reported; a hard limit rejects the change.
+type Limits struct {
+	SoftBytes int64 `json:"softBytes,omitempty"`
+	HardBytes int64 `json:"hardBytes,omitempty"`
+	SoftFiles int64 `json:"softFiles,omitempty"`
+	HardFiles int64 `json:"hardFiles,omitempty"`
+}
+
+// Usage is the storage a user occupies. Files counts every entry below the
+// workspace root: files, directories and links.
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Add returns u with delta applied, never going below zero.
+func (u Usage) Add(delta Usage) Usage {
+	u.Bytes = max(u.Bytes+delta.Bytes, 0)
+	u.Files = max(u.Files+delta.Files, 0)
+	return u
+}
+
+// Neg returns the delta that undoes u.
+func (u Usage) Neg() Usage {
+	return Usage{Bytes: -u.Bytes, Files: -u.Files}
+}
+
+// OverSoft reports whether u is past either soft limit.
+func (l Limits) OverSoft(u Usage) bool {
+	return over(u.Bytes, l.SoftBytes) || over(u.Files, l.SoftFiles)
+}
+
+// OverHard reports whether u is past either hard limit.
+func (l Limits) OverHard(u Usage) bool {
+	return over(u.Bytes, l.HardBytes) || over(u.Files, l.HardFiles)
+}
+
+func over(v, limit int64) bool {
+	return limit > 0 && v > limit
+}
+
+type entry struct {
+	usage        Usage
+	reconciledAt time.Time
+}
+
+// Tracker keeps each user's usage in memory. Handlers update it incrementally
+// as they change the workspace; a periodic scan corrects drift from
+// out-of-band changes and races between the two.
+type Tracker struct {
+	dirs   *fsops.UserDirs
+	limits Limits
+
+	mu    sync.Mutex
+	users map[string]*entry
+	// scanning serialises scans per user so concurrent first requests don't
+	// walk the same workspace twice.
+	scanning map[string]*sync.Mutex
+}
+
+// NewTracker creates a tracker for the workspaces in dirs.
+func NewTracker(dirs *fsops.UserDirs, limits Limits) *Tracker {
+	return &Tracker{
+		dirs:     dirs,
+		limits:   limits,
+		users:    make(map[string]*entry),
+		scanning: make(map[string]*sync.Mutex),
+	}
+}
+
+// Limits returns the configured limits.
+func (t *Tracker) Limits() Limits {
+	return t.limits
+}
+
+// Usage returns userID's current usage and when it was last reconciled with
+// the disk, scanning the workspace if the user is not tracked yet.
+func (t *Tracker) Usage(userID string) (Usage, time.Time, error) {
+	if err := t.ensure(userID); err != nil {
+		return Usage{}, time.Time{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.users[userID]
+	return e.usage, e.reconciledAt, nil
+}
+
+// Tracked returns the usage of every user seen since startup.
+func (t *Tracker) Tracked() map[string]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]Usage, len(t.users))
+	for id, e := range t.users {
+		out[id] = e.usage
+	}
+	return out
+}
+
+// Charge applies delta to userID's usage. A delta that grows usage past a
+// hard limit is refused with ErrExceeded and not applied; shrinking is always
+// allowed. The returned usage is the new total. Callers that fail to make the
+// change they charged for undo it with a negated Charge.
+func (t *Tracker) Charge(userID string, delta Usage) (Usage, error) {
+	if err := t.ensure(userID); err != nil {
+		return Usage{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.users[userID]
+	next := e.usage.Add(delta)
+	if (delta.Bytes > 0 && over(next.Bytes, t.limits.HardBytes)) ||
+		(delta.Files > 0 && over(next.Files, t.limits.HardFiles)) {
+		return e.usage, ErrExceeded
+	}
+	e.usage = next
+	return next, nil
+}
+
+// Reconcile rescans userID's workspace and replaces the tracked usage.
+func (t *Tracker) Reconcile(userID string) error {
+	lock := t.scanLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+	return t.scan(userID)
+}
+
+// Run reconciles every tracked user each interval until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+		userIDs := make([]string, 0, len(t.users))
+		for id := range t.users {
+			userIDs = append(userIDs, id)
+		}
+		t.mu.Unlock()
+
+		for _, id := range userIDs {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := t.Reconcile(id); err != nil {
+				log.Printf("quota: reconcile %s: %v", id, err)
+			}
+		}
+	}
+}
+
+// ensure scans userID's workspace the first time the user is seen.
+func (t *Tracker) ensure(userID string) error {
+	t.mu.Lock()
+	_, ok := t.users[userID]
+	t.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	lock := t.scanLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	t.mu.Lock()
+	_, ok = t.users[userID]
+	t.mu.Unlock()
+	if ok {
+		return nil
+	}
+	return t.scan(userID)
+}
+
+func (t *Tracker) scan(userID string) error {
+	root, err := t.dirs.Root(userID)
+	if err != nil {
+		return err
+	}
+	usage, err := Measure(root)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// The root itself is not an entry the user created.
+	usage.Files = max(usage.Files-1, 0)
+
+	t.mu.Lock()
+	t.users[userID] = &entry{usage: usage, reconciledAt: time.Now().UTC()}
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *Tracker) scanLock(userID string) *sync.Mutex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lock, ok := t.scanning[userID]
+	if !ok {
+		lock = &sync.Mutex{}
+		t.scanning[userID] = lock
+	}
+	return lock
+}
+
+// Measure returns the usage of path and everything below it, counting path
+// itself as one entry. Symlinks are counted but not followed.
+func Measure(path string) (Usage, error) {
+	var usage Usage
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Entries can vanish while we walk.
+			if errors.Is(err, fs.ErrNotExist) && p != path {
+				return nil
+			}
+			return err
+		}
+		usage.Files++
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			usage.Bytes += info.Size()
+		}
+		return nil
+	})
+	return usage, err
+}
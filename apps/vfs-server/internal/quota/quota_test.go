@@ -0,0 +1,112 @@
+package quota
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/protean/vfs-server/internal/fsops"
+)
+
+const testUser = "user-12345678"
+
+func newTestTracker(t *testing.T, limits Limits) (*Tracker, string) {
+	t.Helper()
+	dirs, err := fsops.NewUserDirs(t.TempDir(), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := dirs.Root(testUser)
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "a.txt"), make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("docs/a.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return NewTracker(dirs, limits), root
+}
+
+func TestUsageScansOnFirstUse(t *testing.T) {
+	tracker, _ := newTestTracker(t, Limits{})
+
+	usage, reconciledAt, err := tracker.Usage(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// docs, docs/a.txt and link; the link's target is not counted twice.
+	if usage != (Usage{Bytes: 100, Files: 3}) {
+		t.Fatalf("usage = %+v", usage)
+	}
+	if reconciledAt.IsZero() {
+		t.Fatal("expected a reconcile time")
+	}
+}
+
+func TestChargeEnforcesHardLimits(t *testing.T) {
+	tracker, _ := newTestTracker(t, Limits{SoftBytes: 150, HardBytes: 200, HardFiles: 4})
+
+	usage, err := tracker.Charge(testUser, Usage{Bytes: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tracker.Limits().OverSoft(usage) || tracker.Limits().OverHard(usage) {
+		t.Fatalf("expected usage %+v to be over the soft limit only", usage)
+	}
+
+	if _, err := tracker.Charge(testUser, Usage{Bytes: 41}); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected ErrExceeded for bytes, got %v", err)
+	}
+	if _, err := tracker.Charge(testUser, Usage{Files: 2}); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected ErrExceeded for files, got %v", err)
+	}
+
+	usage, _, _ = tracker.Usage(testUser)
+	if usage != (Usage{Bytes: 160, Files: 3}) {
+		t.Fatalf("refused charges must not be applied, usage = %+v", usage)
+	}
+
+	// Freeing space is always allowed, even when it leaves other limits
+	// exceeded.
+	if _, err := tracker.Charge(testUser, Usage{Bytes: 60}.Neg()); err != nil {
+		t.Fatalf("expected shrinking to succeed, got %v", err)
+	}
+}
+
+func TestReconcileCorrectsDrift(t *testing.T) {
+	tracker, root := newTestTracker(t, Limits{})
+
+	if _, err := tracker.Charge(testUser, Usage{Bytes: 5000, Files: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "out-of-band.bin"), make([]byte, 50), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracker.Reconcile(testUser); err != nil {
+		t.Fatal(err)
+	}
+	usage, _, _ := tracker.Usage(testUser)
+	if usage != (Usage{Bytes: 150, Files: 4}) {
+		t.Fatalf("usage after reconcile = %+v", usage)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	_, root := newTestTracker(t, Limits{})
+
+	usage, err := Measure(filepath.Join(root, "docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != (Usage{Bytes: 100, Files: 2}) {
+		t.Fatalf("Measure(docs) = %+v", usage)
+	}
+
+	if _, err := Measure(filepath.Join(root, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
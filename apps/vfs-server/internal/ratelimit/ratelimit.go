@@ -0,0 +1,123 @@
+// Package ratelimit implements token-bucket rate limiting with pluggable
+// bucket storage.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Request classes with separate budgets.
+const (
+	ClassRead  = "read"
+	ClassWrite = "write"
+)
+
+// Limit configures a bucket: it refills at Rate tokens per second and holds
+// at most Burst. A zero Rate disables limiting.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Store holds bucket state. MemoryStore keeps it in process; an
+// implementation backed by a shared database lets several replicas enforce a
+// common budget.
+type Store interface {
+	// Take removes one token from the bucket key. When the bucket is empty it
+	// returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+// Limiter applies per-class limits to keys.
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+// New creates a limiter over store with a limit per request class.
+func New(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Allow takes a token for key in class. Classes without a limit, or with a
+// zero rate, are always allowed.
+func (l *Limiter) Allow(ctx context.Context, class, key string) (bool, time.Duration, error) {
+	limit, ok := l.limits[class]
+	if !ok || limit.Rate <= 0 {
+		return true, 0, nil
+	}
+	return l.store.Take(ctx, class+"|"+key, limit, time.Now())
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled completely.
+	full time.Time
+}
+
+// sweepInterval is how often idle buckets are dropped from a MemoryStore.
+const sweepInterval = time.Minute
+
+// MemoryStore is an in-process Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty in-process store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+		s.lastSweep = now
+	}
+
+	burst := float64(max(limit.Burst, 1))
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*limit.Rate)
+	}
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(seconds((burst - b.tokens) / limit.Rate))
+
+	if allowed {
+		return true, 0, nil
+	}
+	return false, seconds((1 - b.tokens) / limit.Rate), nil
+}
+
+// sweep drops buckets that have refilled completely, since a fresh bucket
+// behaves the same.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
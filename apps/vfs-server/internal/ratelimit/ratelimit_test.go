@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 2, Burst: 3}
+	now := time.Unix(1_700_000_000, 0)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := store.Take(ctx, "k", limit, now); !ok {
+			t.Fatalf("request %d within burst was refused", i)
+		}
+	}
+
+	ok, retryAfter, _ := store.Take(ctx, "k", limit, now)
+	if ok {
+		t.Fatal("expected the bucket to be empty")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Fatalf("retryAfter = %v, want 500ms", retryAfter)
+	}
+
+	if ok, _, _ := store.Take(ctx, "other", limit, now); !ok {
+		t.Fatal("buckets must be independent per key")
+	}
+
+	if ok, _, _ := store.Take(ctx, "k", limit, now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("expected a token after refilling")
+	}
+	if ok, _, _ := store.Take(ctx, "k", limit, now.Add(500*time.Millisecond)); ok {
+		t.Fatal("expected only one token to have refilled")
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Unix(1_700_000_000, 0)
+	ctx := context.Background()
+
+	store.Take(ctx, "idle", limit, now)
+	store.Take(ctx, "busy", limit, now.Add(2*time.Minute))
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Fatal("expected the refilled bucket to be swept")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Fatal("expected the active bucket to be kept")
+	}
+}
+
+func TestLimiterSeparatesClasses(t *testing.T) {
+	limiter := New(NewMemoryStore(), map[string]Limit{
+		ClassRead:  {Rate: 1, Burst: 1},
+		ClassWrite: {Rate: 0},
+	})
+	ctx := context.Background()
+
+	if ok, _, _ := limiter.Allow(ctx, ClassRead, "svc|user"); !ok {
+		t.Fatal("first read refused")
+	}
+	if ok, _, _ := limiter.Allow(ctx, ClassRead, "svc|user"); ok {
+		t.Fatal("second read should exceed the read budget")
+	}
+	for i := 0; i < 10; i++ {
+		if ok, _, _ := limiter.Allow(ctx, ClassWrite, "svc|user"); !ok {
+			t.Fatal("a zero rate must disable limiting")
+		}
+	}
+}
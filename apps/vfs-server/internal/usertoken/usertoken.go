@@ -0,0 +1,176 @@
+package usertoken
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	algHS256 = "HS256"
+	algEdDSA = "EdDSA"
+
+	// leeway tolerates clock skew between the minting service and us.
+	leeway = 30 * time.Second
+)
+
+// Claims identifies who a request acts for.
+type Claims struct {
+	// Subject is the user ID.
+	Subject string `json:"sub"`
+	// Service must match the service authenticated by its bearer token.
+	Service   string `json:"svc"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf,omitempty"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verifier checks short-lived JWTs that bind a calling service to the user it
+// acts for. Tokens are signed with HS256 (shared secret) or EdDSA (Ed25519).
+type Verifier struct {
+	hmacKeys [][]byte
+	edKeys   []ed25519.PublicKey
+	maxTTL   time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier creates a verifier accepting tokens signed by any of the given
+// keys whose lifetime (exp - iat) does not exceed maxTTL.
+func NewVerifier(hmacKeys [][]byte, edKeys []ed25519.PublicKey, maxTTL time.Duration) *Verifier {
+	return &Verifier{hmacKeys: hmacKeys, edKeys: edKeys, maxTTL: maxTTL, now: time.Now}
+}
+
+// Enabled reports whether any verification key is configured.
+func (v *Verifier) Enabled() bool {
+	return v != nil && (len(v.hmacKeys) > 0 || len(v.edKeys) > 0)
+}
+
+// Verify checks token's signature and timing claims and returns its claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("malformed token")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, errors.New("malformed token header")
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, errors.New("malformed token signature")
+	}
+
+	if !v.verifySignature(h.Alg, signingInput, sig) {
+		return Claims{}, errors.New("invalid token signature")
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Claims{}, errors.New("malformed token claims")
+	}
+	if err := v.validate(c); err != nil {
+		return Claims{}, err
+	}
+	return c, nil
+}
+
+func (v *Verifier) verifySignature(alg string, input, sig []byte) bool {
+	switch alg {
+	case algHS256:
+		for _, key := range v.hmacKeys {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(input)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return true
+			}
+		}
+	case algEdDSA:
+		for _, key := range v.edKeys {
+			if ed25519.Verify(key, input, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *Verifier) validate(c Claims) error {
+	if c.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	if c.Service == "" {
+		return errors.New("token has no service")
+	}
+	if c.ExpiresAt == 0 || c.IssuedAt == 0 {
+		return errors.New("token must carry iat and exp")
+	}
+
+	now := v.now()
+	if now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return errors.New("token expired")
+	}
+	if time.Unix(c.IssuedAt, 0).After(now.Add(leeway)) {
+		return errors.New("token issued in the future")
+	}
+	if c.NotBefore != 0 && time.Unix(c.NotBefore, 0).After(now.Add(leeway)) {
+		return errors.New("token not yet valid")
+	}
+	if v.maxTTL > 0 && time.Duration(c.ExpiresAt-c.IssuedAt)*time.Second > v.maxTTL {
+		return fmt.Errorf("token lifetime exceeds %s", v.maxTTL)
+	}
+	return nil
+}
+
+// SignHS256 mints a token signed with secret.
+func SignHS256(c Claims, secret []byte) (string, error) {
+	input, err := signingInput(algHS256, c)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SignEdDSA mints a token signed with an Ed25519 private key.
+func SignEdDSA(c Claims, key ed25519.PrivateKey) (string, error) {
+	input, err := signingInput(algEdDSA, c)
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(input))), nil
+}
+
+func signingInput(alg string, c Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: alg, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p), nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,105 @@
+package usertoken
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fixedNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func validClaims() Claims {
+	return Claims{
+		Subject:   "user-aaaaaaaa",
+		Service:   "agent",
+		IssuedAt:  fixedNow.Unix(),
+		ExpiresAt: fixedNow.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func newTestVerifier(hmacKeys [][]byte, edKeys []ed25519.PublicKey) *Verifier {
+	v := NewVerifier(hmacKeys, edKeys, 15*time.Minute)
+	v.now = func() time.Time { return fixedNow }
+	return v
+}
+
+func TestVerifyHS256(t *testing.T) {
+	v := newTestVerifier([][]byte{[]byte("old-secret"), []byte("new-secret")}, nil)
+
+	token, err := SignHS256(validClaims(), []byte("new-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "user-aaaaaaaa" || claims.Service != "agent" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	forged, _ := SignHS256(validClaims(), []byte("wrong-secret"))
+	if _, err := v.Verify(forged); err == nil {
+		t.Fatal("expected token signed with an unknown secret to be rejected")
+	}
+}
+
+func TestVerifyEdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(nil, []ed25519.PublicKey{pub})
+
+	token, err := SignEdDSA(validClaims(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An HS256 token must not be accepted just because EdDSA keys exist.
+	hs, _ := SignHS256(validClaims(), pub)
+	if _, err := v.Verify(hs); err == nil {
+		t.Fatal("expected HS256 token to be rejected without HMAC keys")
+	}
+}
+
+func TestVerifyRejectsBadClaims(t *testing.T) {
+	secret := []byte("secret")
+	v := newTestVerifier([][]byte{secret}, nil)
+
+	tests := map[string]func(c *Claims){
+		"expired":        func(c *Claims) { c.ExpiresAt = fixedNow.Add(-time.Minute).Unix() },
+		"future iat":     func(c *Claims) { c.IssuedAt = fixedNow.Add(time.Hour).Unix() },
+		"not yet valid":  func(c *Claims) { c.NotBefore = fixedNow.Add(time.Hour).Unix() },
+		"too long-lived": func(c *Claims) { c.ExpiresAt = fixedNow.Add(24 * time.Hour).Unix() },
+		"no subject":     func(c *Claims) { c.Subject = "" },
+		"no service":     func(c *Claims) { c.Service = "" },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := validClaims()
+			mutate(&c)
+			token, _ := SignHS256(c, secret)
+			if _, err := v.Verify(token); err == nil {
+				t.Fatal("expected token to be rejected")
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgNone(t *testing.T) {
+	v := newTestVerifier([][]byte{[]byte("secret")}, nil)
+
+	token, _ := SignHS256(validClaims(), []byte("secret"))
+	parts := strings.Split(token, ".")
+	// {"alg":"none"}
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+	if _, err := v.Verify(unsigned); err == nil {
+		t.Fatal("expected alg=none token to be rejected")
+	}
+}
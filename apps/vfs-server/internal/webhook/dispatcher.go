@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/protean/vfs-server/internal/events"
+)
+
+// Options tunes delivery behaviour.
+type Options struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	Workers     int
+	// PollInterval is how often the queue is scanned for due retries.
+	PollInterval time.Duration
+	// AllowPrivate lets deliveries connect to loopback, link-local and
+	// private addresses, for development against local receivers.
+	AllowPrivate bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 8
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 2 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	return o
+}
+
+// Payload is the JSON body POSTed to a hook.
+type Payload struct {
+	DeliveryID string      `json:"deliveryId"`
+	HookID     string      `json:"hookId"`
+	Event      EventRecord `json:"event"`
+}
+
+// EventRecord is an events.Event with the owning user made explicit.
+type EventRecord struct {
+	events.Event
+	UserID string `json:"userId"`
+}
+
+// Dispatcher turns broker events into queued deliveries and POSTs them with
+// retries and exponential backoff.
+type Dispatcher struct {
+	store  *Store
+	queue  *Queue
+	opts   Options
+	client *http.Client
+}
+
+// NewDispatcher creates a dispatcher for the hooks in store.
+func NewDispatcher(store *Store, queue *Queue, opts Options) *Dispatcher {
+	opts = opts.withDefaults()
+	return &Dispatcher{
+		store:  store,
+		queue:  queue,
+		opts:   opts,
+		client: newClient(opts.Timeout, opts.AllowPrivate),
+	}
+}
+
+// Run consumes events from broker until ctx is cancelled, then waits for
+// in-flight deliveries to finish.
+func (d *Dispatcher) Run(ctx context.Context, broker *events.Broker) {
+	jobs := make(chan *Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < d.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				d.attempt(job)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	sub, _, _ := broker.Subscribe("", 0)
+	defer func() { broker.Unsubscribe(sub) }()
+	var lastID uint64
+
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// We fell behind; resubscribe and replay what we missed.
+				var replay []events.Event
+				sub, replay, _ = broker.Subscribe("", lastID)
+				for _, e := range replay {
+					lastID = e.ID
+					d.enqueue(e)
+				}
+				continue
+			}
+			lastID = e.ID
+			d.enqueue(e)
+		case <-ticker.C:
+		}
+
+		for _, job := range d.queue.Due(time.Now(), d.opts.Workers) {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				d.queue.Retry(job)
+				return
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(e events.Event) {
+	for _, h := range d.store.Matching(e) {
+		scoped, _ := h.Scope(e)
+		delivery := &Delivery{
+			ID:          randomHex(12),
+			HookID:      h.ID,
+			NextAttempt: time.Now(),
+		}
+		payload, err := json.Marshal(Payload{
+			DeliveryID: delivery.ID,
+			HookID:     h.ID,
+			Event:      EventRecord{Event: scoped, UserID: e.UserID},
+		})
+		if err != nil {
+			log.Printf("webhook: encode event %d: %v", e.ID, err)
+			continue
+		}
+		delivery.Payload = payload
+		if err := d.queue.Enqueue(delivery); err != nil {
+			log.Printf("webhook: enqueue delivery for hook %s: %v", h.ID, err)
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(job *Delivery) {
+	hook, ok := d.store.Get(job.HookID)
+	if !ok {
+		// The hook was removed; drop its backlog.
+		d.queue.Complete(job)
+		return
+	}
+
+	err := d.post(hook, job)
+	if err == nil {
+		if err := d.queue.Complete(job); err != nil {
+			log.Printf("webhook: complete delivery %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	if job.Attempts >= d.opts.MaxAttempts {
+		log.Printf("webhook: giving up on delivery %s to %s after %d attempts: %v", job.ID, hook.URL, job.Attempts, err)
+		if err := d.queue.Bury(job); err != nil {
+			log.Printf("webhook: bury delivery %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.NextAttempt = time.Now().Add(d.backoff(job.Attempts))
+	if err := d.queue.Retry(job); err != nil {
+		log.Printf("webhook: reschedule delivery %s: %v", job.ID, err)
+	}
+}
+
+func (d *Dispatcher) post(hook Hook, job *Delivery) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return err
+	}
+
+	var payload Payload
+	json.Unmarshal(job.Payload, &payload)
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "protean-vfs-webhook/1")
+	req.Header.Set("X-Vfs-Event", payload.Event.Type)
+	req.Header.Set("X-Vfs-Delivery", job.ID)
+	req.Header.Set("X-Vfs-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Vfs-Signature", Sign(hook.Secret, timestamp, job.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.opts.MaxBackoff {
+			return d.opts.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Sign returns the X-Vfs-Signature value for body: an HMAC-SHA256 over
+// "<timestamp>.<body>" keyed with the hook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
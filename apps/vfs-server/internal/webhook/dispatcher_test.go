@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/protean/vfs-server/internal/events"
+)
+
+func TestDispatcherDeliversSignedEventWithRetry(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	received := make(chan Payload, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get("X-Vfs-Timestamp"), 10, 64)
+		if got, want := r.Header.Get("X-Vfs-Signature"), Sign("s3cret", ts, body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+
+		var p Payload
+		json.Unmarshal(body, &p)
+		received <- p
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	// httptest servers listen on loopback.
+	store, err := OpenStore(filepath.Join(dir, "hooks.json"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Hook{URL: srv.URL, Secret: "s3cret", UserID: "user-aaaaaaaa", PathPrefix: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := OpenQueue(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := events.NewBroker(16)
+	d := NewDispatcher(store, queue, Options{
+		BaseBackoff:  10 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		AllowPrivate: true,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, broker)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Give Run a moment to subscribe.
+	time.Sleep(20 * time.Millisecond)
+	broker.Publish(events.Event{Type: events.TypeCreate, UserID: "user-bbbbbbbb", Path: "docs/a.txt"})
+	broker.Publish(events.Event{Type: events.TypeCreate, UserID: "user-aaaaaaaa", Path: "other/a.txt"})
+	broker.Publish(events.Event{Type: events.TypeCreate, UserID: "user-aaaaaaaa", Path: "docs/a.txt"})
+
+	select {
+	case p := <-received:
+		if p.Event.UserID != "user-aaaaaaaa" || p.Event.Path != "docs/a.txt" {
+			t.Fatalf("unexpected payload %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for queue.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if queue.Len() != 0 {
+		t.Fatalf("expected empty queue after delivery, got %d", queue.Len())
+	}
+}
+
+func TestQueueSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(&Delivery{ID: "d1", HookID: "h1", Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due := reopened.Due(time.Now(), 10)
+	if len(due) != 1 || due[0].ID != "d1" {
+		t.Fatalf("expected persisted delivery d1, got %+v", due)
+	}
+
+	due[0].Attempts = 3
+	if err := reopened.Bury(due[0]); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 0 {
+		t.Fatalf("expected buried delivery to leave the queue")
+	}
+}
+
+func TestBackoffIsExponentialAndCapped(t *testing.T) {
+	d := NewDispatcher(nil, nil, Options{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := d.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestHookValidate(t *testing.T) {
+	if err := (Hook{URL: "ftp://example.com"}).Validate(false); err == nil {
+		t.Error("expected non-http URL to be rejected")
+	}
+	if err := (Hook{URL: "https://example.com/hook", Events: []string{"explode"}}).Validate(false); err == nil {
+		t.Error("expected unknown event type to be rejected")
+	}
+	if err := (Hook{URL: "https://example.com/hook", Events: []string{events.TypeRename}}).Validate(false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, prefix := range []string{"../other-user", "docs/../../x", "..\\x"} {
+		if err := (Hook{URL: "https://example.com/hook", PathPrefix: prefix}).Validate(false); err == nil {
+			t.Errorf("expected path prefix %q to be rejected", prefix)
+		}
+	}
+
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://api.localhost./hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if err := (Hook{URL: u}).Validate(false); err == nil {
+			t.Errorf("expected %s to be rejected", u)
+		}
+		if err := (Hook{URL: u}).Validate(true); err != nil {
+			t.Errorf("%s with private targets allowed: %v", u, err)
+		}
+	}
+}
+
+func TestStoreAddCleansPathPrefix(t *testing.T) {
+	s, err := OpenStore(filepath.Join(t.TempDir(), "webhooks.json"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		"/docs/":      "docs",
+		"docs//a/./b": "docs/a/b",
+		".":           "",
+	} {
+		h, err := s.Add(Hook{URL: "https://example.com/hook", PathPrefix: in})
+		if err != nil {
+			t.Fatalf("Add(%q): %v", in, err)
+		}
+		if h.PathPrefix != want {
+			t.Errorf("Add(%q) stored prefix %q, want %q", in, h.PathPrefix, want)
+		}
+	}
+	if _, err := s.Add(Hook{URL: "https://example.com/hook", PathPrefix: "docs/../.."}); !errors.Is(err, ErrInvalidHook) {
+		t.Errorf("expected traversal prefix to be refused with ErrInvalidHook, got %v", err)
+	}
+}
+
+func TestDeliveryRefusesPrivateAddresses(t *testing.T) {
+	var hits int
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	// Delivery does not revalidate the URL, so this is refused by the
+	// dialer, as a name rebound to loopback after registration would be.
+	d := &Dispatcher{client: newClient(time.Second, false)}
+	err := d.post(Hook{URL: srv.URL}, &Delivery{Payload: []byte("{}")})
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("expected ErrBlockedAddress, got %v", err)
+	}
+
+	// Redirects are not followed, even to a public address.
+	redirect := httptest.NewServer(http.RedirectHandler("http://example.com/", http.StatusFound))
+	defer redirect.Close()
+	d = &Dispatcher{client: newClient(time.Second, true)}
+	if err := d.post(Hook{URL: redirect.URL}, &Delivery{Payload: []byte("{}")}); err == nil {
+		t.Fatal("expected a redirect to fail the delivery")
+	}
+	if hits != 0 {
+		t.Fatalf("expected no request to reach the loopback server, got %d", hits)
+	}
+}
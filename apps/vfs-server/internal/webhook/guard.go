@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned for hook URLs and connections that reach a
+// loopback, link-local, private or otherwise internal address. Hooks are
+// registered by clients, so without this they could make the server probe
+// its own network or a cloud metadata endpoint.
+var ErrBlockedAddress = errors.New("webhook address is not publicly routable")
+
+var (
+	// sharedAddressSpace is carrier-grade NAT space (RFC 6598).
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+	// thisNetwork is 0.0.0.0/8, which some stacks route to the local host.
+	thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+)
+
+// blockedAddr reports whether addr is one hooks may not be delivered to.
+func blockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr) ||
+		thisNetwork.Contains(addr)
+}
+
+// checkHost refuses a URL host that is a blocked address literal or a
+// localhost name. Other names are checked as they are dialled, which also
+// covers a name that is rebound to an internal address after registration.
+func checkHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrBlockedAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && blockedAddr(addr) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// dialControl refuses connections to blocked addresses. It runs after name
+// resolution, on the address actually being connected to.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("webhook: unexpected dial address %q", address)
+	}
+	if blockedAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ap.Addr())
+	}
+	return nil
+}
+
+// newClient returns the HTTP client deliveries are made with. Redirects are
+// not followed, since the target of one was never validated, and proxies
+// from the environment are ignored so that the dialled address is the
+// hook's own.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = dialControl
+	}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delivery is a single pending POST of an event to a hook.
+type Delivery struct {
+	ID          string          `json:"id"`
+	HookID      string          `json:"hookId"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Queue persists pending deliveries as one JSON file each so they survive
+// restarts. Deliveries that exhaust their retries are moved to dead/.
+type Queue struct {
+	mu       sync.Mutex
+	dir      string
+	deadDir  string
+	pending  map[string]*Delivery
+	inFlight map[string]bool
+}
+
+// OpenQueue loads pending deliveries from dir.
+func OpenQueue(dir string) (*Queue, error) {
+	q := &Queue{
+		dir:      filepath.Join(dir, "pending"),
+		deadDir:  filepath.Join(dir, "dead"),
+		pending:  make(map[string]*Delivery),
+		inFlight: make(map[string]bool),
+	}
+	for _, d := range []string{q.dir, q.deadDir} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return nil, fmt.Errorf("webhook queue: %w", err)
+		}
+	}
+
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("webhook queue: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("webhook queue: %w", err)
+		}
+		var d Delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			log.Printf("webhook: skipping corrupt delivery %s: %v", e.Name(), err)
+			continue
+		}
+		q.pending[d.ID] = &d
+	}
+	return q, nil
+}
+
+// Enqueue persists d and schedules it for delivery.
+func (q *Queue) Enqueue(d *Delivery) error {
+	if err := q.write(q.dir, d); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.pending[d.ID] = d
+	q.mu.Unlock()
+	return nil
+}
+
+// Due claims up to limit deliveries whose next attempt is at or before now.
+func (q *Queue) Due(now time.Time, limit int) []*Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []*Delivery
+	for id, d := range q.pending {
+		if len(due) == limit {
+			break
+		}
+		if q.inFlight[id] || d.NextAttempt.After(now) {
+			continue
+		}
+		q.inFlight[id] = true
+		copied := *d
+		due = append(due, &copied)
+	}
+	return due
+}
+
+// Len returns the number of pending deliveries.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Complete removes a successfully delivered item.
+func (q *Queue) Complete(d *Delivery) error {
+	q.mu.Lock()
+	delete(q.pending, d.ID)
+	delete(q.inFlight, d.ID)
+	q.mu.Unlock()
+
+	if err := os.Remove(q.file(q.dir, d.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Retry records a failed attempt and reschedules d.
+func (q *Queue) Retry(d *Delivery) error {
+	err := q.write(q.dir, d)
+
+	q.mu.Lock()
+	q.pending[d.ID] = d
+	delete(q.inFlight, d.ID)
+	q.mu.Unlock()
+	return err
+}
+
+// Bury moves d to the dead-letter directory after its final attempt.
+func (q *Queue) Bury(d *Delivery) error {
+	q.mu.Lock()
+	delete(q.pending, d.ID)
+	delete(q.inFlight, d.ID)
+	q.mu.Unlock()
+
+	if err := q.write(q.deadDir, d); err != nil {
+		return err
+	}
+	if err := os.Remove(q.file(q.dir, d.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (q *Queue) write(dir string, d *Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.file(dir, d.ID), data)
+}
+
+func (q *Queue) file(dir, id string) string {
+	return filepath.Join(dir, id+".json")
+}
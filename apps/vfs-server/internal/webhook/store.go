@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/protean/vfs-server/internal/config"
+	"github.com/protean/vfs-server/internal/events"
+)
+
+var (
+	// ErrNotFound is returned when a hook does not exist or is not visible
+	// to the caller.
+	ErrNotFound = errors.New("webhook not found")
+	// ErrInvalidHook wraps the reason Add refuses a hook.
+	ErrInvalidHook = errors.New("invalid webhook")
+)
+
+// Hook is a registered webhook. A hook with an empty UserID is global and
+// receives events for every user. Service is the authenticated service that
+// registered it.
+type Hook struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret"`
+	UserID     string    `json:"userId,omitempty"`
+	Service    string    `json:"service,omitempty"`
+	PathPrefix string    `json:"pathPrefix,omitempty"`
+	Events     []string  `json:"events,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Matches reports whether e should be delivered to h.
+func (h Hook) Matches(e events.Event) bool {
+	_, ok := h.Scope(e)
+	return ok
+}
+
+// Scope returns e as h should receive it: scoped to h.PathPrefix, so a
+// rename across the prefix arrives as a create or delete, and filtered
+// on the resulting type.
+func (h Hook) Scope(e events.Event) (events.Event, bool) {
+	if h.UserID != "" && h.UserID != e.UserID {
+		return events.Event{}, false
+	}
+	scoped, ok := e.Scoped(h.PathPrefix)
+	if !ok {
+		return events.Event{}, false
+	}
+	if len(h.Events) > 0 {
+		found := false
+		for _, t := range h.Events {
+			if t == scoped.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return events.Event{}, false
+		}
+	}
+	return scoped, true
+}
+
+// Validate checks the hook's URL, path prefix and event filter. Unless
+// allowPrivate is set, a URL naming a loopback, link-local or private
+// address is refused; a name resolving to one is refused when a delivery
+// dials it.
+func (h Hook) Validate(allowPrivate bool) error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if !allowPrivate {
+		if err := checkHost(u.Hostname()); err != nil {
+			return fmt.Errorf("url must not point at a loopback, link-local or private address")
+		}
+	}
+	for _, part := range strings.Split(strings.ReplaceAll(h.PathPrefix, "\\", "/"), "/") {
+		if part == ".." {
+			return fmt.Errorf("pathPrefix must not contain \"..\"")
+		}
+	}
+	for _, t := range h.Events {
+		switch t {
+		case events.TypeCreate, events.TypeModify, events.TypeDelete, events.TypeRename:
+		default:
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// Store keeps registered hooks in memory and persists them to a JSON file.
+type Store struct {
+	mu           sync.RWMutex
+	path         string
+	hooks        map[string]Hook
+	allowPrivate bool
+}
+
+// OpenStore loads hooks from path, creating an empty store if it is missing.
+// allowPrivate lets hooks target internal addresses; see Hook.Validate.
+func OpenStore(path string, allowPrivate bool) (*Store, error) {
+	s := &Store{path: path, hooks: make(map[string]Hook), allowPrivate: allowPrivate}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read webhooks: %w", err)
+	}
+
+	var hooks []Hook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, fmt.Errorf("parse webhooks: %w", err)
+	}
+	for _, h := range hooks {
+		s.hooks[h.ID] = h
+	}
+	return s, nil
+}
+
+// Add registers h, assigning an ID, creation time and (if empty) a secret.
+// A hook that fails Validate is refused with an error wrapping
+// ErrInvalidHook.
+func (s *Store) Add(h Hook) (Hook, error) {
+	if err := h.Validate(s.allowPrivate); err != nil {
+		return Hook{}, fmt.Errorf("%w: %v", ErrInvalidHook, err)
+	}
+	h.ID = randomHex(8)
+	if h.Secret == "" {
+		h.Secret = randomHex(32)
+	}
+	h.PathPrefix = config.CleanWorkspacePath(h.PathPrefix)
+	h.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks[h.ID] = h
+	if err := s.saveLocked(); err != nil {
+		delete(s.hooks, h.ID)
+		return Hook{}, err
+	}
+	return h, nil
+}
+
+// Remove deletes the hook with id if it is owned by userID. Global hooks are
+// removed by passing an empty userID.
+func (s *Store) Remove(id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.hooks[id]
+	if !ok || h.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.hooks, id)
+	if err := s.saveLocked(); err != nil {
+		s.hooks[id] = h
+		return err
+	}
+	return nil
+}
+
+// Get returns the hook with id.
+func (s *Store) Get(id string) (Hook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.hooks[id]
+	return h, ok
+}
+
+// List returns the hooks owned by userID plus all global hooks.
+func (s *Store) List(userID string) []Hook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hooks := make([]Hook, 0, len(s.hooks))
+	for _, h := range s.hooks {
+		if h.UserID == "" || h.UserID == userID {
+			hooks = append(hooks, h)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks
+}
+
+// Matching returns the hooks that should receive e.
+func (s *Store) Matching(e events.Event) []Hook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hooks []Hook
+	for _, h := range s.hooks {
+		if h.Matches(e) {
+			hooks = append(hooks, h)
+		}
+	}
+	return hooks
+}
+
+func (s *Store) saveLocked() error {
+	hooks := make([]Hook, 0, len(s.hooks))
+	for _, h := range s.hooks {
+		hooks = append(hooks, h)
+	}
+	data, err := json.MarshalIndent(hooks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces path with data via a temporary file and rename.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -16,6 +16,11 @@ import {
 import { requireUserId } from "@/lib/server/auth-user";
 import { getAgentMemory } from "@/lib/server/agent-memory";
 import { canAccessThread } from "@/lib/server/thread-utils";
+import {
+  endRouteSpan,
+  spanTraceHeaders,
+  startRouteSpan,
+} from "@/lib/server/tracing";
 
 function isPendingMessage(message: UIMessage): boolean {
   const metadata = (
@@ -108,13 +113,6 @@ export async function POST(request: Request) {
     return Response.json({ error: "Thread not found" }, { status: 404 });
   }
 
-  const fs = await createRemoteFs({
-    baseUrl: process.env.VFS_SERVER_URL!,
-    serviceToken: process.env.VFS_SERVICE_TOKEN!,
-    userId,
-    logger: consoleLogger,
-  });
-
   // For making sure the model selection and the reasoning budget are valid.
   const requestSelection = parseModelSelection(parsedBody.modelSelection);
   const resolvedModelSelection = resolveModelSelection({
@@ -185,86 +183,105 @@ export async function POST(request: Request) {
     }
   }
 
-  const agent = await createRootAgent(
-    {
-      fs,
-      modelSelection: {
-        providerId: fullModelEntry.providerId,
-        modelId: resolvedModelSelection.modelId,
-        reasoningBudget: resolvedModelSelection.reasoningBudget,
-        runtimeProvider: fullModelEntry.runtimeProvider,
+  // The agent's file operations are traced under this span, which lasts
+  // until the response stream finishes.
+  const span = startRouteSpan("POST /agent/chat");
+  try {
+    const fs = await createRemoteFs({
+      baseUrl: process.env.VFS_SERVER_URL!,
+      serviceToken: process.env.VFS_SERVICE_TOKEN!,
+      userId,
+      logger: consoleLogger,
+      traceHeaders: () => spanTraceHeaders(span),
+    });
+
+    const agent = await createRootAgent(
+      {
+        fs,
+        modelSelection: {
+          providerId: fullModelEntry.providerId,
+          modelId: resolvedModelSelection.modelId,
+          reasoningBudget: resolvedModelSelection.reasoningBudget,
+          runtimeProvider: fullModelEntry.runtimeProvider,
+        },
       },
-    },
-    consoleLogger,
-  );
+      consoleLogger,
+    );
 
-  const compactionResult = await memory.compactIfNeeded(threadId, {
-    policy: {
-      maxContextTokens: fullModelEntry.contextLimits.total,
-      reservedOutputTokens: fullModelEntry.contextLimits.maxOutput,
-    },
-    summarizeHistory: async (history) => summarizeHistory(history),
-  });
+    const compactionResult = await memory.compactIfNeeded(threadId, {
+      policy: {
+        maxContextTokens: fullModelEntry.contextLimits.total,
+        reservedOutputTokens: fullModelEntry.contextLimits.maxOutput,
+      },
+      summarizeHistory: async (history) => summarizeHistory(history),
+    });
 
-  if (compactionResult) {
-    thread = compactionResult.thread;
-    if (!thread) {
-      return Response.json({ error: "Thread not found" }, { status: 404 });
+    if (compactionResult) {
+      thread = compactionResult.thread;
+      if (!thread) {
+        endRouteSpan(span);
+        return Response.json({ error: "Thread not found" }, { status: 404 });
+      }
     }
-  }
 
-  const activeHistory = deriveActiveHistory(thread).map(
-    (record) => record.message,
-  );
-
-  const streamStartMs = Date.now();
-  const stream = await agent.stream({
-    messages: await convertToModelMessages(activeHistory),
-    abortSignal: request.signal,
-  });
+    const activeHistory = deriveActiveHistory(thread).map(
+      (record) => record.message,
+    );
 
-  return stream.toUIMessageStreamResponse({
-    sendReasoning: true,
-    sendSources: false,
-    originalMessages: activeHistory,
-    onFinish: async ({ isAborted, responseMessage }) => {
-      const reloaded = await memory.getThreadWithMessages(threadId);
-      if (!reloaded || !canAccessThread(reloaded, userId)) {
-        return;
-      }
+    const streamStartMs = Date.now();
+    const stream = await agent.stream({
+      messages: await convertToModelMessages(activeHistory),
+      abortSignal: request.signal,
+    });
 
-      const totalDurationMs = Math.max(Date.now() - streamStartMs, 0);
-      let inputTokens = 0;
-      let outputTokens = 0;
+    return stream.toUIMessageStreamResponse({
+      sendReasoning: true,
+      sendSources: false,
+      originalMessages: activeHistory,
+      onFinish: async ({ isAborted, responseMessage }) => {
+        endRouteSpan(span);
+        const reloaded = await memory.getThreadWithMessages(threadId);
+        if (!reloaded || !canAccessThread(reloaded, userId)) {
+          return;
+        }
 
-      try {
-        if (!isAborted) {
-          const usage = await stream.usage;
-          inputTokens = usage.inputTokens ?? 0;
-          outputTokens = usage.outputTokens ?? 0;
+        const totalDurationMs = Math.max(Date.now() - streamStartMs, 0);
+        let inputTokens = 0;
+        let outputTokens = 0;
+
+        try {
+          if (!isAborted) {
+            const usage = await stream.usage;
+            inputTokens = usage.inputTokens ?? 0;
+            outputTokens = usage.outputTokens ?? 0;
+          }
+        } catch {
+          inputTokens = 0;
+          outputTokens = 0;
         }
-      } catch {
-        inputTokens = 0;
-        outputTokens = 0;
-      }
 
-      await memory.upsertMessage(threadId, {
-        message: responseMessage,
-        modelSelection: thread.modelSelection,
-        usage: {
-          inputTokens,
-          outputTokens,
-          totalDurationMs,
-        },
-      });
-    },
-    onError: (error) => {
-      console.error("Failed to finish agent run:", error);
+        await memory.upsertMessage(threadId, {
+          message: responseMessage,
+          modelSelection: thread.modelSelection,
+          usage: {
+            inputTokens,
+            outputTokens,
+            totalDurationMs,
+          },
+        });
+      },
+      onError: (error) => {
+        console.error("Failed to finish agent run:", error);
+        endRouteSpan(span, error);
 
-      if (error instanceof Error) {
-        return error.message;
-      }
-      return "Failed to stream response from model.";
-    },
-  });
+        if (error instanceof Error) {
+          return error.message;
+        }
+        return "Failed to stream response from model.";
+      },
+    });
+  } catch (error) {
+    endRouteSpan(span, error);
+    throw error;
+  }
 }
@@ -1,6 +1,11 @@
 import { NextRequest, NextResponse } from "next/server";
 import { requireUserId } from "@/lib/server/auth-user";
 import { createRemoteFs } from "@protean/vfs";
+import {
+  endRouteSpan,
+  spanTraceHeaders,
+  startRouteSpan,
+} from "@/lib/server/tracing";
 
 export async function GET(request: NextRequest) {
   const userId = await requireUserId();
@@ -10,13 +15,15 @@ export async function GET(request: NextRequest) {
 
   const dir = request.nextUrl.searchParams.get("dir") ?? "/";
 
-  const fs = await createRemoteFs({
-    baseUrl: process.env.VFS_SERVER_URL!,
-    serviceToken: process.env.VFS_SERVICE_TOKEN!,
-    userId,
-  });
-
+  const span = startRouteSpan("GET /api/files");
   try {
+    const fs = await createRemoteFs({
+      baseUrl: process.env.VFS_SERVER_URL!,
+      serviceToken: process.env.VFS_SERVICE_TOKEN!,
+      userId,
+      traceHeaders: () => spanTraceHeaders(span),
+    });
+
     const dirEntries = await fs.readdir(dir);
 
     const entries = await Promise.all(
@@ -62,9 +69,12 @@ export async function GET(request: NextRequest) {
     if (message.includes("NOT_FOUND") || message.includes("not found")) {
       return NextResponse.json({ entries: [], dir });
     }
+    endRouteSpan(span, err);
     return NextResponse.json(
       { error: "Failed to list directory" },
       { status: 500 },
     );
+  } finally {
+    endRouteSpan(span);
   }
 }
@@ -0,0 +1,18 @@
+/**
+ * Starts OpenTelemetry tracing when an OTLP endpoint is configured through
+ * the standard `OTEL_EXPORTER_OTLP_ENDPOINT` variable. Like the vfs-server,
+ * tracing is off by default.
+ */
+export async function register() {
+  if (
+    process.env.NEXT_RUNTIME !== "nodejs" ||
+    !process.env.OTEL_EXPORTER_OTLP_ENDPOINT
+  ) {
+    return;
+  }
+
+  const { NodeSDK } = await import("@opentelemetry/sdk-node");
+  new NodeSDK({
+    serviceName: process.env.OTEL_SERVICE_NAME ?? "protean-webapp",
+  }).start();
+}
@@ -0,0 +1,46 @@
+import {
+  context,
+  propagation,
+  SpanKind,
+  SpanStatusCode,
+  trace,
+  type Span,
+} from "@opentelemetry/api";
+
+const tracer = trace.getTracer("@protean/webapp");
+
+/**
+ * Starts the server span for a route handler. It always begins a new trace:
+ * a `traceparent` sent by the browser is not trusted, since it would let any
+ * client attach requests to an arbitrary trace or force sampling. The caller
+ * ends the span with `endRouteSpan`.
+ */
+export function startRouteSpan(name: string): Span {
+  return tracer.startSpan(name, { kind: SpanKind.SERVER, root: true });
+}
+
+/**
+ * Ends `span`, marking it failed when `error` is given. Spans that already
+ * ended are left alone, so streaming routes can call it from every exit.
+ */
+export function endRouteSpan(span: Span, error?: unknown) {
+  if (!span.isRecording()) {
+    return;
+  }
+  if (error !== undefined) {
+    span.recordException(error instanceof Error ? error : String(error));
+    span.setStatus({ code: SpanStatusCode.ERROR });
+  }
+  span.end();
+}
+
+/**
+ * W3C trace context headers naming `span` as the parent, for the RemoteFS
+ * `traceHeaders` option. Empty unless tracing is enabled in
+ * instrumentation.ts.
+ */
+export function spanTraceHeaders(span: Span): Record<string, string> {
+  const headers: Record<string, string> = {};
+  propagation.inject(trace.setSpan(context.active(), span), headers);
+  return headers;
+}
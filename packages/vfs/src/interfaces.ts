@@ -7,11 +7,29 @@ export interface FileStat {
   size: number;
   isDirectory: boolean;
   modified: string;
+  /** Birth time when `birthtimeKnown`, otherwise the modification time. */
   created: string;
+  isSymlink?: boolean;
+  /** Link target, for symlinks. */
+  target?: string;
+  birthtimeKnown?: boolean;
+  accessed?: string;
+  changed?: string;
+  /** st_mode including the file type bits, as in Node's `fs.Stats.mode`. */
+  mode?: number;
+  /** Permission bits in octal, e.g. "0644". */
+  permissions?: string;
+  /** Inode number as a decimal string, since it may exceed 2^53. */
+  inode?: string;
+  nlink?: number;
+  /** Content type of a regular file, when requested with `mime`. */
+  mime?: string;
+  /** "sha256:<hex>" when the server knows the file's digest. */
+  hash?: string;
 }
 
 export interface FS {
-  stat(filePath: string): Promise<FileStat>;
+  stat(filePath: string, options?: { mime?: boolean }): Promise<FileStat>;
   readdir(dirPath: string): Promise<FileEntry[]>;
   readFile(filePath: string): Promise<string>;
   readFileBuffer(filePath: string): Promise<Buffer>;
@@ -1,5 +1,5 @@
 import { afterEach, describe, expect, test } from "bun:test";
-import { createRemoteFs } from "./remote-fs";
+import { createRemoteFs, uploadChecksum } from "./remote-fs";
 
 const originalFetch = globalThis.fetch;
 
@@ -55,6 +55,43 @@ describe("createRemoteFs", () => {
     });
   });
 
+  test("maps VFS error codes to errno codes", async () => {
+    const cases: Array<[string, number, string]> = [
+      ["ALREADY_EXISTS", 409, "EEXIST"],
+      ["NOT_DIRECTORY", 409, "ENOTDIR"],
+      ["IS_DIRECTORY", 409, "EISDIR"],
+      ["NOT_EMPTY", 409, "ENOTEMPTY"],
+      ["PERMISSION_DENIED", 403, "EACCES"],
+      ["NO_SPACE", 507, "ENOSPC"],
+      ["READ_ONLY", 503, "EROFS"],
+      ["NAME_TOO_LONG", 400, "ENAMETOOLONG"],
+    ];
+
+    for (const [vfsCode, status, errno] of cases) {
+      globalThis.fetch = (async (input) => {
+        if (String(input).endsWith("/api/v1/files/mkdir")) {
+          return jsonResponse(200, { ok: true, data: { created: true } });
+        }
+        return jsonResponse(status, {
+          ok: false,
+          error: { code: vfsCode, message: "failed", requestId: "req-1" },
+        });
+      }) as typeof fetch;
+
+      const fs = await createRemoteFs({
+        baseUrl: "http://vfs.example",
+        serviceToken: "token",
+        userId: "user-12345678",
+      });
+
+      await expect(fs.readFile("notes.txt")).rejects.toMatchObject({
+        code: errno,
+        vfsCode,
+        requestId: "req-1",
+      });
+    }
+  });
+
   test("prepares workspace during initialization", async () => {
     const calls: Array<{ url: string; method: string; body?: string }> = [];
     globalThis.fetch = (async (input, init) => {
@@ -137,4 +174,53 @@ describe("createRemoteFs", () => {
     expect(moveCall?.body).toContain('"path":"docs/old.txt"');
     expect(moveCall?.body).toContain('"newPath":"archive/new.txt"');
   });
+
+  test("sends trace context headers on every request", async () => {
+    const seen: Array<Record<string, string>> = [];
+    globalThis.fetch = (async (_input, init) => {
+      seen.push(init?.headers as Record<string, string>);
+      return jsonResponse(200, { ok: true, data: { created: true } });
+    }) as typeof fetch;
+
+    await createRemoteFs({
+      baseUrl: "http://vfs.example",
+      serviceToken: "token",
+      userId: "user-12345678",
+      traceHeaders: () => ({
+        traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+      }),
+    });
+
+    expect(seen[0]?.traceparent).toBe(
+      "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+    );
+    expect(seen[0]?.["Authorization"]).toBe("Bearer token");
+  });
+
+  test("sends an X-Checksum with uploads", async () => {
+    const seen: Array<{ url: string; headers: Record<string, string> }> = [];
+    globalThis.fetch = (async (input, init) => {
+      seen.push({
+        url: String(input),
+        headers: init?.headers as Record<string, string>,
+      });
+      return jsonResponse(200, { ok: true, data: { bytesWritten: 5 } });
+    }) as typeof fetch;
+
+    const fs = await createRemoteFs({
+      baseUrl: "http://vfs.example",
+      serviceToken: "token",
+      userId: "user-12345678",
+    });
+    await fs.writeFile("a.txt", "hello");
+    await fs.writeFileBuffer("b.bin", Buffer.from("hello"));
+
+    const checksum =
+      "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824";
+    expect(uploadChecksum("hello")).toBe(checksum);
+    for (const path of ["/api/v1/files/write", "/api/v1/files/write-binary"]) {
+      const call = seen.find((c) => c.url.endsWith(path));
+      expect(call?.headers["X-Checksum"]).toBe(checksum);
+    }
+  });
 });
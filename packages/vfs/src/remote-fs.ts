@@ -1,3 +1,4 @@
+import { createHash } from "crypto";
 import { normalize } from "path";
 import { type Logger } from "@protean/logger";
 import { type FS } from "./interfaces";
@@ -7,6 +8,21 @@ interface RemoteFsConfig {
   serviceToken: string;
   userId: string;
   logger?: Logger;
+  /**
+   * Returns W3C trace context headers (`traceparent`, `tracestate`) to send
+   * with each request, so the vfs-server's spans join the caller's trace.
+   * They should come from a span the caller started, not from headers it
+   * received.
+   */
+  traceHeaders?: () => Record<string, string>;
+}
+
+/**
+ * `X-Checksum` value for an upload. The vfs-server verifies it against the
+ * file content before committing the write.
+ */
+export function uploadChecksum(content: string | Uint8Array): string {
+  return `sha256:${createHash("sha256").update(content).digest("hex")}`;
 }
 
 interface VfsEnvelope<T> {
@@ -15,18 +31,39 @@ interface VfsEnvelope<T> {
   error?: {
     code?: string;
     message?: string;
+    requestId?: string;
   };
 }
 
+const VFS_ERRNO_CODES: Record<string, NodeJS.ErrnoException["code"]> = {
+  NOT_FOUND: "ENOENT",
+  ALREADY_EXISTS: "EEXIST",
+  NOT_DIRECTORY: "ENOTDIR",
+  IS_DIRECTORY: "EISDIR",
+  NOT_EMPTY: "ENOTEMPTY",
+  PERMISSION_DENIED: "EACCES",
+  PATH_TRAVERSAL: "EACCES",
+  NO_SPACE: "ENOSPC",
+  QUOTA_EXCEEDED: "EDQUOT",
+  READ_ONLY: "EROFS",
+  NAME_TOO_LONG: "ENAMETOOLONG",
+  CHECKSUM_MISMATCH: "EIO",
+};
+
 function mapErrnoCode(
   status: number,
   vfsCode?: string,
 ): NodeJS.ErrnoException["code"] | undefined {
-  if (vfsCode === "NOT_FOUND" || status === 404) {
+  const mapped = vfsCode ? VFS_ERRNO_CODES[vfsCode] : undefined;
+  if (mapped) {
+    return mapped;
+  }
+
+  if (status === 404) {
     return "ENOENT";
   }
 
-  if (vfsCode === "PATH_TRAVERSAL" || status === 403) {
+  if (status === 403) {
     return "EACCES";
   }
 
@@ -47,12 +84,15 @@ function buildVfsError(
     status?: number;
     statusText?: string;
     vfsCode?: string;
+    requestId?: string;
   };
 
   error.name = "VfsRequestError";
   error.status = res.status;
   error.statusText = res.statusText;
   error.vfsCode = vfsCode;
+  error.requestId =
+    envelope?.error?.requestId ?? res.headers.get("x-request-id") ?? undefined;
 
   const errnoCode = mapErrnoCode(res.status, vfsCode);
   if (errnoCode) {
@@ -63,11 +103,12 @@ function buildVfsError(
 }
 
 export async function createRemoteFs(config: RemoteFsConfig): Promise<FS> {
-  const { baseUrl, serviceToken, userId, logger } = config;
+  const { baseUrl, serviceToken, userId, logger, traceHeaders } = config;
   const base = baseUrl.replace(/\/+$/, "");
 
   function headers(): Record<string, string> {
     return {
+      ...traceHeaders?.(),
       "Authorization": `Bearer ${serviceToken}`,
       "X-User-Id": userId,
     };
@@ -126,10 +167,11 @@ export async function createRemoteFs(config: RemoteFsConfig): Promise<FS> {
   });
 
   return {
-    stat: async (filePath) => {
+    stat: async (filePath, options) => {
       logger?.debug("RemoteFS.stat", { filePath });
       const q = encodeURIComponent(normalizePath(filePath));
-      return fetchJson(`${base}/api/v1/files/stat?path=${q}`);
+      const mime = options?.mime ? "&mime=true" : "";
+      return fetchJson(`${base}/api/v1/files/stat?path=${q}${mime}`);
     },
 
     readdir: async (dirPath) => {
@@ -175,7 +217,10 @@ export async function createRemoteFs(config: RemoteFsConfig): Promise<FS> {
       logger?.debug("RemoteFS.writeFile", { filePath, bytes: content.length });
       await fetchJson(`${base}/api/v1/files/write`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
+        headers: {
+          "Content-Type": "application/json",
+          "X-Checksum": uploadChecksum(content),
+        },
         body: JSON.stringify({ path: normalizePath(filePath), content }),
       });
     },
@@ -192,6 +237,7 @@ export async function createRemoteFs(config: RemoteFsConfig): Promise<FS> {
       formData.append("file", new Blob([blobPayload]));
       const res = await request(`${base}/api/v1/files/write-binary`, {
         method: "POST",
+        headers: { "X-Checksum": uploadChecksum(content) },
         body: formData,
       });
       const envelope = await parseEnvelope(res);